@@ -0,0 +1,124 @@
+package gstorage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// NewURLSignerFromADC creates a new URLSigner using Application Default
+// Credentials. See WithDefaultCredentials.
+func NewURLSignerFromADC(ctx context.Context, opts ...Option) (*URLSigner, error) {
+	return NewURLSigner(append(opts, WithDefaultCredentials(ctx))...)
+}
+
+// WithDefaultCredentials is an option that locates Application Default
+// Credentials, in the same order as golang.org/x/oauth2/google's
+// FindDefaultCredentials:
+//
+//  1. the file named by the GOOGLE_APPLICATION_CREDENTIALS environment variable
+//  2. the gcloud well-known application default credentials file
+//  3. the metadata server, when running on Google Compute Engine
+//
+// Discovery is done directly instead of with FindDefaultCredentials, as
+// package gstorage does not depend on golang.org/x/oauth2 (or, through it,
+// cloud.google.com/go/compute/metadata).
+//
+// Service account credential files are used for local key signing, and
+// external account credential files are used as described in
+// WithExternalAccountJSON. When credentials are provided by the metadata
+// server, signing is done with the IAM Credentials API's signBlob method on
+// behalf of the instance's default service account.
+func WithDefaultCredentials(ctx context.Context) Option {
+	return func(u *URLSigner) error {
+		// environment variable
+		if path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); path != "" {
+			buf, err := ioutil.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("could not read GOOGLE_APPLICATION_CREDENTIALS: %v", err)
+			}
+			return withCredentialsFileJSON(buf)(u)
+		}
+		// well-known file
+		if path := wellKnownCredentialsFile(); path != "" {
+			buf, err := ioutil.ReadFile(path)
+			switch {
+			case err == nil:
+				return withCredentialsFileJSON(buf)(u)
+			case !os.IsNotExist(err):
+				return fmt.Errorf("could not read %s: %v", path, err)
+			}
+		}
+		// metadata server
+		return WithMetadataServer(ctx)(u)
+	}
+}
+
+// WithGoogleCredentialsJSON is an option that uses the JSON encoded
+// credentials already held by an application, such as the JSON field of a
+// golang.org/x/oauth2/google Credentials:
+//
+//	creds, err := google.FindDefaultCredentials(ctx, scopes...)
+//	// ...
+//	signer, err := gstorage.NewURLSigner(gstorage.WithGoogleCredentialsJSON(ctx, creds.JSON))
+//
+// Service account and external account credentials are supported. When buf
+// is empty (as when the credentials were provided by the metadata server),
+// then the metadata server is used as with WithMetadataServer.
+//
+// The JSON is accepted instead of a *google.Credentials, as package gstorage
+// does not depend on golang.org/x/oauth2. The credentials' TokenSource is not
+// used, as signing requires either the private key in the JSON, or the
+// metadata server's default service account.
+func WithGoogleCredentialsJSON(ctx context.Context, buf []byte) Option {
+	if len(buf) == 0 {
+		return WithMetadataServer(ctx)
+	}
+	return withCredentialsFileJSON(buf)
+}
+
+// withCredentialsFileJSON returns an option for the JSON encoded credentials
+// file, based on its type.
+func withCredentialsFileJSON(buf []byte) Option {
+	return func(u *URLSigner) error {
+		var v struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(buf, &v); err != nil {
+			return fmt.Errorf("could not decode credentials file: %v", err)
+		}
+		switch v.Type {
+		case "service_account":
+			return WithCredentialsJSON(buf)(u)
+		case "external_account":
+			return WithExternalAccountJSON(buf)(u)
+		case "authorized_user":
+			return errors.New("authorized_user credentials cannot sign urls, use service account credentials")
+		}
+		return fmt.Errorf("unsupported credentials type %q", v.Type)
+	}
+}
+
+// wellKnownCredentialsFile returns the path of the gcloud application default
+// credentials file.
+func wellKnownCredentialsFile() string {
+	const name = "application_default_credentials.json"
+	if runtime.GOOS == "windows" {
+		if dir := os.Getenv("APPDATA"); dir != "" {
+			return filepath.Join(dir, "gcloud", name)
+		}
+		return ""
+	}
+	if dir := os.Getenv("CLOUDSDK_CONFIG"); dir != "" {
+		return filepath.Join(dir, name)
+	}
+	if home := os.Getenv("HOME"); home != "" {
+		return filepath.Join(home, ".config", "gcloud", name)
+	}
+	return ""
+}
@@ -0,0 +1,123 @@
+package gstorage
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// testCredentialsJSON returns JSON encoded service account credentials for
+// testdata/key.pem.
+func testCredentialsJSON(t *testing.T) []byte {
+	t.Helper()
+	key, err := ioutil.ReadFile("testdata/key.pem")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	buf, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"client_email":   "test@example.iam.gserviceaccount.com",
+		"private_key_id": "0123456789abcdef",
+		"private_key":    string(key),
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	return buf
+}
+
+// setenv sets the environment variables for the duration of the test.
+func setenv(t *testing.T, env map[string]string) {
+	t.Helper()
+	for k, v := range env {
+		prev, ok := os.LookupEnv(k)
+		if err := os.Setenv(k, v); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		k := k
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(k, prev)
+			} else {
+				os.Unsetenv(k)
+			}
+		})
+	}
+}
+
+func TestWithDefaultCredentials(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("well-known credentials file is in APPDATA on windows")
+	}
+	want := loadTestKey(t)
+	dir, err := ioutil.TempDir("", "gstorage")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	envPath := filepath.Join(dir, "credentials.json")
+	if err := ioutil.WriteFile(envPath, testCredentialsJSON(t), 0600); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	wellKnown := filepath.Join(dir, "gcloud")
+	if err := os.Mkdir(wellKnown, 0700); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(wellKnown, "application_default_credentials.json"), testCredentialsJSON(t), 0600); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	tests := []struct {
+		env map[string]string
+		err bool
+	}{
+		{map[string]string{"GOOGLE_APPLICATION_CREDENTIALS": envPath, "CLOUDSDK_CONFIG": dir}, false},
+		{map[string]string{"GOOGLE_APPLICATION_CREDENTIALS": "", "CLOUDSDK_CONFIG": wellKnown}, false},
+		{map[string]string{"GOOGLE_APPLICATION_CREDENTIALS": filepath.Join(dir, "missing.json"), "CLOUDSDK_CONFIG": wellKnown}, true},
+	}
+	for i, test := range tests {
+		t.Run("", func(t *testing.T) {
+			setenv(t, test.env)
+			u, err := NewURLSigner(WithDefaultCredentials(context.Background()))
+			switch {
+			case test.err && err == nil:
+				t.Fatalf("test %d expected error", i)
+			case test.err:
+				return
+			case err != nil:
+				t.Fatalf("test %d expected no error, got: %v", i, err)
+			}
+			if u.ClientEmail != "test@example.iam.gserviceaccount.com" {
+				t.Errorf("test %d expected client email, got: %q", i, u.ClientEmail)
+			}
+			if !u.PrivateKey.Equal(want) {
+				t.Errorf("test %d private key does not match testdata/key.pem", i)
+			}
+		})
+	}
+}
+
+func TestWithGoogleCredentialsJSON(t *testing.T) {
+	u, err := NewURLSigner(WithGoogleCredentialsJSON(context.Background(), testCredentialsJSON(t)))
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if u.ClientEmail != "test@example.iam.gserviceaccount.com" || !u.PrivateKey.Equal(loadTestKey(t)) {
+		t.Errorf("expected signer for the credentials, got: %q", u.ClientEmail)
+	}
+	// metadata server credentials have no json
+	const email = "default@example.iam.gserviceaccount.com"
+	newTestMetadataServer(t, email)
+	if u, err = NewURLSigner(WithGoogleCredentialsJSON(context.Background(), nil)); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if _, ok := u.Backend.(*IAMBackend); !ok || u.ClientEmail != email {
+		t.Errorf("expected metadata server signer, got: %T %q", u.Backend, u.ClientEmail)
+	}
+	if _, err := NewURLSigner(WithGoogleCredentialsJSON(context.Background(), []byte(`{"type":"authorized_user"}`))); err == nil {
+		t.Error("expected error for authorized_user credentials")
+	}
+}
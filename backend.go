@@ -0,0 +1,92 @@
+package gstorage
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Backend is the interface for remote signing backends.
+type Backend interface {
+	// SignBytes signs buf using RSA-SHA256, returning the raw signature.
+	SignBytes(ctx context.Context, buf []byte) ([]byte, error)
+}
+
+// DigestSigner is the interface for signing backends that can sign
+// precomputed digests, such as Cloud KMS. Backends that are not a
+// DigestSigner can only generate RSA-SHA256 signatures (see
+// WithSignatureHash).
+type DigestSigner interface {
+	// SignDigest signs the digest generated with hash, returning the raw
+	// signature, or an error if the hash is not supported.
+	SignDigest(ctx context.Context, hash crypto.Hash, digest []byte) ([]byte, error)
+}
+
+// TokenSource is the interface for OAuth2 access token sources used by
+// remote signing backends.
+type TokenSource interface {
+	// AccessToken returns a valid OAuth2 access token.
+	AccessToken(ctx context.Context) (string, error)
+}
+
+// tokenResponse is an OAuth2 access token response.
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// tokenCache caches an access token until shortly before it expires.
+type tokenCache struct {
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// get returns the cached token, retrieving a new token with f when the
+// cached token is missing or expired.
+func (c *tokenCache) get(ctx context.Context, f func(context.Context) (string, time.Time, error)) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Now().Before(c.expiry) {
+		return c.token, nil
+	}
+	tok, expiry, err := f(ctx)
+	if err != nil {
+		return "", err
+	}
+	c.token, c.expiry = tok, expiry.Add(-time.Minute)
+	return c.token, nil
+}
+
+// apiError is a Google API error response.
+type apiError struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+// doJSON performs the request, decoding the JSON response into v.
+func doJSON(client *http.Client, req *http.Request, v interface{}) error {
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer drain(res)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		buf, _ := ioutil.ReadAll(res.Body)
+		var e apiError
+		if json.Unmarshal(buf, &e) == nil && e.Error.Message != "" {
+			return fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Host, res.Status, e.Error.Message)
+		}
+		return fmt.Errorf("%s %s: %s", req.Method, req.URL.Host, res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
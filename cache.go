@@ -0,0 +1,82 @@
+package gstorage
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CacheControl is a Cache-Control header value for uploads, which Google Cloud
+// Storage saves as the object's Cache-Control metadata and serves with the
+// object.
+type CacheControl string
+
+// Cache-Control presets.
+const (
+	// CacheImmutable is the Cache-Control value for immutable assets, such as
+	// content addressed (fingerprinted) files, cached publicly for a year.
+	CacheImmutable CacheControl = "public, max-age=31536000, immutable"
+
+	// CacheNoStore is the Cache-Control value for content that must never be
+	// cached.
+	CacheNoStore CacheControl = "no-store"
+
+	// CacheNoCache is the Cache-Control value for content that may be cached,
+	// but must be revalidated before each use.
+	CacheNoCache CacheControl = "no-cache"
+
+	// CacheShort is the Cache-Control value for frequently changing content,
+	// cached publicly for 5 minutes.
+	CacheShort CacheControl = "public, max-age=300"
+
+	// CachePrivate is the Cache-Control value for user specific content,
+	// which may only be cached by the client, for 1 hour.
+	CachePrivate CacheControl = "private, max-age=3600"
+)
+
+// CacheMaxAge returns the Cache-Control value for content cached for d
+// (rounded down to the second), publicly (ie, by shared caches) or only by
+// the client.
+func CacheMaxAge(d time.Duration, public bool) CacheControl {
+	scope := "private"
+	if public {
+		scope = "public"
+	}
+	return CacheControl(scope + ", max-age=" + strconv.FormatInt(int64(d/time.Second), 10))
+}
+
+// Apply sets the Cache-Control header of the signing params, replacing any
+// existing value, so it is included in the signing params' required headers
+// (see SigningParams.RequiredHeaders), and in V4 signatures. V2 signatures
+// only include x-goog-* headers, so the header is not signed with V2.
+func (cc CacheControl) Apply(p *SigningParams) {
+	headers := make(http.Header, len(p.Headers)+1)
+	for name, v := range p.Headers {
+		if strings.ToLower(strings.TrimSpace(name)) != "cache-control" {
+			headers[name] = v
+		}
+	}
+	headers["cache-control"] = []string{string(cc)}
+	p.Headers = headers
+}
+
+// WithCacheControl is an option that sets the Cache-Control header of all
+// uploads (PUT and POST requests) signed by the URLSigner, so that caching
+// policy is enforced when URLs are issued, instead of trusting clients. The
+// header replaces any Cache-Control header in the signing params, and must
+// be sent by clients (see SigningParams.RequiredHeaders).
+//
+// The header is only enforced by V4 signed URLs (see WithSigningScheme), as
+// V2 signatures only include x-goog-* headers: with V2, the header is sent
+// but not signed, so clients could omit or change it.
+func WithCacheControl(cc CacheControl) Option {
+	return func(u *URLSigner) error {
+		if cc == "" || validateHeaderValue(string(cc)) != nil {
+			return fmt.Errorf("invalid cache control %q", cc)
+		}
+		u.setUploadHeader("cache-control", string(cc))
+		return nil
+	}
+}
@@ -0,0 +1,62 @@
+package gstorage
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithCacheControl(t *testing.T) {
+	key := loadTestKey(t)
+	// v2 signs only x-goog-* headers
+	u := &URLSigner{PrivateKey: key, ClientEmail: "test@example.com"}
+	for _, o := range []Option{
+		WithCacheControl(CacheImmutable),
+		WithMeta("source", "test"),
+	} {
+		if err := o(u); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+	s, err := u.MakeSigned(&SigningParams{Method: "PUT", Bucket: "bucket", Object: "file.txt"}, time.Hour)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if cc := s.Headers["Cache-Control"]; cc != string(CacheImmutable) {
+		t.Errorf("expected Cache-Control header %q, got: %q", CacheImmutable, cc)
+	}
+	v, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	q := v.Query()
+	if _, err := strconv.ParseInt(q.Get("Expires"), 10, 64); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	str := "PUT\n\n\n" + q.Get("Expires") + "\nx-goog-meta-source:test\n/bucket/file.txt"
+	sig, err := base64.StdEncoding.DecodeString(q.Get("Signature"))
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	digest := sha256.Sum256([]byte(str))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+		t.Errorf("expected v2 string to sign without cache-control, got: %v", err)
+	}
+	// v4 signs all headers
+	u.scheme = SigningSchemeV4
+	if s, err = u.MakeSigned(&SigningParams{Method: "PUT", Bucket: "bucket", Object: "file.txt"}, time.Hour); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if v, err = url.Parse(s.URL); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if h := v.Query().Get("X-Goog-SignedHeaders"); !strings.Contains(h, "cache-control") {
+		t.Errorf("expected cache-control to be signed, got: %q", h)
+	}
+}
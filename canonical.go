@@ -0,0 +1,44 @@
+package gstorage
+
+// Canonicalizer is the interface for building the string to sign of V2
+// signed URLs from signing params, used by the URLSigner to generate
+// signatures. See WithCanonicalizer.
+type Canonicalizer interface {
+	// StringToSign returns the string to sign for the signing params.
+	StringToSign(p *SigningParams) (string, error)
+}
+
+// CanonicalizerFunc wraps a func as a Canonicalizer.
+type CanonicalizerFunc func(p *SigningParams) (string, error)
+
+// StringToSign satisfies the Canonicalizer interface.
+func (f CanonicalizerFunc) StringToSign(p *SigningParams) (string, error) {
+	return f(p)
+}
+
+// DefaultCanonicalizer is the Google Cloud Storage V2 canonicalizer, using the
+// signing params' string (see SigningParams.String).
+var DefaultCanonicalizer Canonicalizer = CanonicalizerFunc(func(p *SigningParams) (string, error) {
+	return p.String(), nil
+})
+
+// WithCanonicalizer is an option that sets the canonicalizer used for
+// building the string to sign of V2 signed URLs, such as for S3-compatible
+// backends. The signing params are checked (see SigningParams.Validate) and
+// have the URLSigner's headers added before being passed to the
+// canonicalizer. V4 signed URLs always use the V4 canonical request.
+func WithCanonicalizer(c Canonicalizer) Option {
+	return func(u *URLSigner) error {
+		u.canonicalizer = c
+		return nil
+	}
+}
+
+// stringToSign returns the string to sign for the signing params, using the
+// URLSigner's canonicalizer.
+func (u *URLSigner) stringToSign(p *SigningParams) (string, error) {
+	if u.canonicalizer != nil {
+		return u.canonicalizer.StringToSign(p)
+	}
+	return DefaultCanonicalizer.StringToSign(p)
+}
@@ -2,9 +2,13 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/kenshaw/gstorage"
@@ -12,34 +16,107 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		migrateMain(os.Args[2:])
+		return
+	}
 	flagCreds := flag.String("creds", "", "google service account credentials")
-	flagMethod := flag.String("X", "GET", "http method [GET, PUT, DELETE]")
+	flagMethod := flag.String("X", "GET", "http method [GET, HEAD, OPTIONS, PUT, DELETE]")
 	flagBucket := flag.String("bucket", "my-test-bucket", "bucket")
 	flagPath := flag.String("path", "/test/file.txt", "path")
 	flagExp := flag.Duration("exp", 1*time.Hour, "expiration duration")
 	flag.Parse()
-	if err := run(*flagCreds, *flagMethod, *flagBucket, *flagPath, *flagExp); err != nil {
+	if err := run(*flagCreds, *flagMethod, *flagBucket, *flagPath, *flagExp, flag.Args()); err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
 	}
 }
 
-func run(creds, method, bucket, path string, exp time.Duration) error {
+func run(creds, method, bucket, path string, exp time.Duration, urls []string) error {
 	signer, err := gstorage.NewURLSigner(
-		gstorage.GoogleServiceAccountCredentialsFile(creds),
+		gstorage.WithCredentialsFile(creds),
 	)
 	if err != nil {
 		return err
 	}
-	// generate url
-	out, err := signer.MakeURL(method, bucket, path, exp, nil)
-	if err != nil {
-		return err
+	// expand gs:// urls
+	var objs []gstorage.ObjectInfo
+	for _, urlstr := range urls {
+		v, err := signer.Expand(context.Background(), urlstr)
+		if err != nil {
+			return err
+		}
+		objs = append(objs, v...)
+	}
+	if len(urls) == 0 {
+		objs = append(objs, gstorage.ObjectInfo{Bucket: bucket, Name: path})
+	}
+	// generate urls
+	out := make([]string, len(objs))
+	for i, obj := range objs {
+		if out[i], err = signer.MakeURL(method, obj.Bucket, obj.Name, exp, nil); err != nil {
+			return err
+		}
 	}
 	// make the output a little nicer
-	if isatty.IsTerminal(os.Stdout.Fd()) {
-		out += "\n"
+	s := strings.Join(out, "\n")
+	if len(out) > 1 || isatty.IsTerminal(os.Stdout.Fd()) {
+		s += "\n"
 	}
-	_, err = fmt.Fprintf(os.Stdout, "%s", out)
+	_, err = fmt.Fprintf(os.Stdout, "%s", s)
 	return err
 }
+
+// migrateMain is the entry point for the migrate subcommand, which re-signs
+// V2 signed URLs as V4 signed URLs.
+func migrateMain(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s migrate [flags] [manifest ...]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	flagCreds := fs.String("creds", "", "google service account credentials")
+	flagMethod := fs.String("X", "GET", "default http method for urls without a method")
+	_ = fs.Parse(args)
+	if err := migrate(*flagCreds, *flagMethod, fs.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// migrate reads V2 signed URLs from the manifest (or log) files, or from
+// stdin when no files are specified, and writes the V2 to V4 mapping report
+// to stdout as JSON lines.
+func migrate(creds, method string, files []string) error {
+	signer, err := gstorage.NewURLSigner(
+		gstorage.WithCredentialsFile(creds),
+	)
+	if err != nil {
+		return err
+	}
+	readers := []io.Reader{os.Stdin}
+	if len(files) != 0 {
+		readers = readers[:0]
+		for _, file := range files {
+			f, err := os.Open(file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			readers = append(readers, f)
+		}
+	}
+	enc := json.NewEncoder(os.Stdout)
+	for _, r := range readers {
+		res, err := signer.MigrateURLs(context.Background(), r, method)
+		if err != nil {
+			return err
+		}
+		for _, m := range res {
+			if err := enc.Encode(m); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package gstorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SignedURLOptions are signed URL options, matching the fields of the
+// cloud.google.com/go/storage package's SignedURLOptions, for use with
+// SignedURLWithOptions when migrating code written against the official
+// client.
+type SignedURLOptions struct {
+	// GoogleAccessID is the client email of the signer.
+	GoogleAccessID string
+
+	// PrivateKey is the PEM or DER encoded private key. Exactly one of
+	// PrivateKey or SignBytes must be supplied.
+	PrivateKey []byte
+
+	// SignBytes signs buf using RSA-SHA256. Exactly one of PrivateKey or
+	// SignBytes must be supplied.
+	SignBytes func(buf []byte) ([]byte, error)
+
+	// Method is the HTTP method (GET, PUT, ...).
+	Method string
+
+	// Expires is the expiration time.
+	Expires time.Time
+
+	// ContentType is the content type of the uploaded file.
+	ContentType string
+
+	// Headers are the extra headers, formatted as name:value.
+	Headers []string
+
+	// MD5 is the base64 encoded md5 hash of the file content for an upload.
+	MD5 string
+
+	// Insecure toggles using http instead of https.
+	Insecure bool
+
+	// Scheme is the signing scheme.
+	Scheme SigningScheme
+}
+
+// signBytesFunc wraps a SignBytes func as a Backend.
+type signBytesFunc func([]byte) ([]byte, error)
+
+// SignBytes satisfies the Backend interface.
+func (f signBytesFunc) SignBytes(_ context.Context, buf []byte) ([]byte, error) {
+	return f(buf)
+}
+
+// SignedURLWithOptions generates a signed URL for the bucket and object
+// using the options, as with the cloud.google.com/go/storage package's
+// SignedURL func.
+func SignedURLWithOptions(bucket, object string, opts *SignedURLOptions) (string, error) {
+	if opts == nil {
+		return "", errors.New("missing signed url options")
+	}
+	if opts.Method == "" {
+		return "", errors.New("missing method")
+	}
+	if opts.Expires.IsZero() {
+		return "", errors.New("missing expiration")
+	}
+	o := []Option{WithClientEmail(opts.GoogleAccessID), WithSigningScheme(opts.Scheme)}
+	switch {
+	case opts.PrivateKey != nil && opts.SignBytes == nil:
+		o = append(o, WithPrivateKey(opts.PrivateKey))
+	case opts.PrivateKey == nil && opts.SignBytes != nil:
+		o = append(o, WithBackend(signBytesFunc(opts.SignBytes)))
+	default:
+		return "", errors.New("exactly one of PrivateKey or SignBytes must be supplied")
+	}
+	u, err := NewURLSigner(o...)
+	if err != nil {
+		return "", err
+	}
+	p := &SigningParams{
+		Method:      opts.Method,
+		Hash:        opts.MD5,
+		ContentType: opts.ContentType,
+		Expiration:  opts.Expires,
+		Bucket:      bucket,
+		Object:      object,
+	}
+	if opts.Insecure {
+		p.BaseURL = &url.URL{Scheme: "http", Host: strings.TrimPrefix(DefaultBaseURL, "https://")}
+	}
+	if len(opts.Headers) != 0 {
+		p.Headers = make(http.Header, len(opts.Headers))
+		for _, h := range opts.Headers {
+			i := strings.IndexByte(h, ':')
+			if i == -1 {
+				return "", fmt.Errorf("invalid header %q", h)
+			}
+			p.Headers[h[:i]] = append(p.Headers[h[:i]], h[i+1:])
+		}
+	}
+	return u.Make(p, 0)
+}
@@ -0,0 +1,58 @@
+package gstorage
+
+import (
+	"encoding/xml"
+	"errors"
+	"time"
+)
+
+// MaxComposeComponents is the maximum number of source objects of a compose
+// request.
+const MaxComposeComponents = 32
+
+// ComposeURL creates a signed URL for the XML API compose operation,
+// concatenating source objects in the bucket into the object at path. The
+// client sends a PUT request to the URL with the body generated by
+// ComposeRequest, and the returned headers.
+//
+// When contentType is not empty, it is used as the composed object's content
+// type, and must be sent by the client.
+func (u *URLSigner) ComposeURL(bucket, path, contentType string, d time.Duration) (*SignedURL, error) {
+	return u.MakeSigned(&SigningParams{
+		Method:      "PUT",
+		ContentType: contentType,
+		Bucket:      bucket,
+		Object:      path,
+		Subresource: "compose",
+	}, d)
+}
+
+// composeRequest is a XML API compose request.
+type composeRequest struct {
+	XMLName    xml.Name           `xml:"ComposeRequest"`
+	Components []composeComponent `xml:"Component"`
+}
+
+// composeComponent is a XML API compose request source object.
+type composeComponent struct {
+	Name string `xml:"Name"`
+}
+
+// ComposeRequest returns the XML encoded body of a compose request for the
+// names of the source objects, in order. See ComposeURL.
+func ComposeRequest(names ...string) ([]byte, error) {
+	switch {
+	case len(names) == 0:
+		return nil, errors.New("missing compose source objects")
+	case len(names) > MaxComposeComponents:
+		return nil, errors.New("too many compose source objects")
+	}
+	var req composeRequest
+	for _, name := range names {
+		if err := ValidateObjectName(name); err != nil {
+			return nil, err
+		}
+		req.Components = append(req.Components, composeComponent{Name: name})
+	}
+	return xml.Marshal(req)
+}
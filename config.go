@@ -0,0 +1,170 @@
+package gstorage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// Config is a signer configuration file.
+//
+// Only JSON encoded configuration files are supported, as package gstorage
+// does not depend on a YAML package. As the field names are taken from the
+// json struct tags, YAML files can be converted to JSON (eg, with
+// sigs.k8s.io/yaml's YAMLToJSON) and loaded with ParseConfig.
+type Config struct {
+	// Signers are the named signer configs.
+	Signers map[string]SignerConfig `json:"signers"`
+}
+
+// SignerConfig is the configuration for a signer.
+//
+// The key source is one of CredentialsFile, PrivateKeyFile, or PKCS12File.
+// When no key source is specified, then the metadata server's default
+// service account will be used, if available.
+type SignerConfig struct {
+	// CredentialsFile is the path to Google Service Account credentials.
+	CredentialsFile string `json:"credentials_file,omitempty"`
+
+	// PrivateKeyFile is the path to a PEM or DER encoded private key.
+	PrivateKeyFile string `json:"private_key_file,omitempty"`
+
+	// PKCS12File is the path to a PKCS#12 (.p12) file.
+	PKCS12File string `json:"pkcs12_file,omitempty"`
+
+	// PKCS12Password is the password for the PKCS#12 file. If empty, then
+	// DefaultPKCS12Password will be used instead.
+	PKCS12Password string `json:"pkcs12_password,omitempty"`
+
+	// ClientEmail is the client email, overriding the client email of the
+	// key source.
+	ClientEmail string `json:"client_email,omitempty"`
+
+	// Bucket is the default bucket.
+	Bucket string `json:"bucket,omitempty"`
+
+	// Expiration is the default expiration (eg, 15m), as parsed by
+	// time.ParseDuration. If empty, then DefaultExpiration will be used
+	// instead.
+	Expiration string `json:"expiration,omitempty"`
+
+	// Methods are the allowed HTTP methods. If empty, then all methods are
+	// allowed.
+	Methods []string `json:"methods,omitempty"`
+
+	// Prefixes are the allowed object path prefixes. If empty, then all
+	// objects are allowed.
+	Prefixes []string `json:"prefixes,omitempty"`
+
+	// ContentTypes are the allowed upload content types. If empty, then all
+	// content types are allowed.
+	ContentTypes []string `json:"content_types,omitempty"`
+}
+
+// ConfiguredSigner is a URLSigner created from a signer config, along with
+// the config's default bucket and expiration.
+type ConfiguredSigner struct {
+	// Signer is the URLSigner.
+	Signer *URLSigner
+
+	// Bucket is the default bucket.
+	Bucket string
+
+	// Expiration is the default expiration.
+	Expiration time.Duration
+}
+
+// MakeURL creates a signed URL for the method using the default bucket and
+// expiration.
+func (s *ConfiguredSigner) MakeURL(method, path string, headers map[string]string) (string, error) {
+	if s.Bucket == "" {
+		return "", errors.New("signer has no default bucket")
+	}
+	return s.Signer.MakeURL(method, s.Bucket, path, s.Expiration, headers)
+}
+
+// LoadConfig loads a JSON encoded signer configuration file (see Config),
+// creating the configured signers. The opts are applied to each created
+// URLSigner after the config's options.
+func LoadConfig(path string, opts ...Option) (map[string]*ConfiguredSigner, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read config file: %v", err)
+	}
+	return ParseConfig(buf, opts...)
+}
+
+// ParseConfig parses a JSON encoded signer configuration (see Config),
+// creating the configured signers, as with LoadConfig.
+func ParseConfig(buf []byte, opts ...Option) (map[string]*ConfiguredSigner, error) {
+	var c Config
+	if err := json.Unmarshal(buf, &c); err != nil {
+		return nil, fmt.Errorf("could not decode config file (only json is supported): %v", err)
+	}
+	return c.Build(opts...)
+}
+
+// Build creates the configured signers for the config.
+func (c Config) Build(opts ...Option) (map[string]*ConfiguredSigner, error) {
+	signers := make(map[string]*ConfiguredSigner, len(c.Signers))
+	for name, sc := range c.Signers {
+		s, err := sc.Build(opts...)
+		if err != nil {
+			return nil, fmt.Errorf("signer %s: %v", name, err)
+		}
+		signers[name] = s
+	}
+	return signers, nil
+}
+
+// Build creates the configured signer for the signer config.
+func (sc SignerConfig) Build(opts ...Option) (*ConfiguredSigner, error) {
+	var o []Option
+	switch {
+	case sc.CredentialsFile != "" && sc.PrivateKeyFile == "" && sc.PKCS12File == "":
+		o = append(o, WithCredentialsFile(sc.CredentialsFile))
+	case sc.PrivateKeyFile != "" && sc.CredentialsFile == "" && sc.PKCS12File == "":
+		buf, err := ioutil.ReadFile(sc.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read private key file: %v", err)
+		}
+		o = append(o, WithPrivateKey(buf))
+	case sc.PKCS12File != "" && sc.CredentialsFile == "" && sc.PrivateKeyFile == "":
+		o = append(o, WithPKCS12(sc.PKCS12File, sc.PKCS12Password))
+	case sc.CredentialsFile != "" || sc.PrivateKeyFile != "" || sc.PKCS12File != "":
+		return nil, errors.New("only one of credentials_file, private_key_file, or pkcs12_file may be specified")
+	}
+	if sc.ClientEmail != "" {
+		o = append(o, WithClientEmail(sc.ClientEmail))
+	}
+	if sc.Bucket != "" {
+		o = append(o, WithDefaultBucket(sc.Bucket))
+	}
+	if len(sc.Methods) != 0 || len(sc.Prefixes) != 0 || len(sc.ContentTypes) != 0 {
+		o = append(o, WithPolicy(Policy{Methods: sc.Methods, Prefixes: sc.Prefixes, ContentTypes: sc.ContentTypes}))
+	}
+	expiration := DefaultExpiration
+	if sc.Expiration != "" {
+		var err error
+		if expiration, err = time.ParseDuration(sc.Expiration); err != nil || expiration <= 0 {
+			return nil, fmt.Errorf("invalid expiration %q", sc.Expiration)
+		}
+		o = append(o, WithDefaultExpiration(expiration))
+	}
+	o = append(o, opts...)
+	if sc.CredentialsFile == "" && sc.PrivateKeyFile == "" && sc.PKCS12File == "" {
+		o = append(o, withMetadataFallback(context.Background()))
+	}
+	u, err := NewURLSigner(o...)
+	if err != nil {
+		return nil, err
+	}
+	return &ConfiguredSigner{
+		Signer:     u,
+		Bucket:     sc.Bucket,
+		Expiration: expiration,
+	}, nil
+}
@@ -0,0 +1,69 @@
+package gstorage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gstorage")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.json")
+	const config = `{
+	"signers": {
+		"uploads": {
+			"private_key_file": "testdata/key.pem",
+			"client_email": "uploads@example.com",
+			"bucket": "uploads",
+			"expiration": "5m",
+			"methods": ["PUT"],
+			"prefixes": ["incoming/"]
+		},
+		"downloads": {
+			"pkcs12_file": "testdata/legacy.p12",
+			"client_email": "downloads@example.com"
+		}
+	}
+}`
+	if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	signers, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if len(signers) != 2 {
+		t.Fatalf("expected 2 signers, got: %d", len(signers))
+	}
+	uploads := signers["uploads"]
+	if uploads.Bucket != "uploads" || uploads.Expiration != 5*time.Minute || uploads.Signer.ClientEmail != "uploads@example.com" {
+		t.Errorf("unexpected uploads signer %+v", uploads)
+	}
+	if _, err := uploads.MakeURL("PUT", "incoming/file.txt", nil); err != nil {
+		t.Errorf("expected no error, got: %v", err)
+	}
+	if _, err := uploads.MakeURL("GET", "incoming/file.txt", nil); err == nil {
+		t.Error("expected error for method not allowed by policy")
+	}
+	downloads := signers["downloads"]
+	if !downloads.Signer.PrivateKey.Equal(loadTestKey(t)) {
+		t.Error("downloads signer key does not match testdata/key.pem")
+	}
+	if _, err := downloads.MakeURL("GET", "file.txt", nil); err == nil {
+		t.Error("expected error for signer without default bucket")
+	}
+}
+
+func TestParseConfigYAML(t *testing.T) {
+	_, err := ParseConfig([]byte("signers:\n  uploads:\n    bucket: uploads\n"))
+	if err == nil || !strings.Contains(err.Error(), "only json is supported") {
+		t.Errorf("expected json only error, got: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package gstorage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// PendingUpload is a signed upload URL paired with the expected attributes of
+// the uploaded object, used to confirm uploads made by untrusted clients.
+type PendingUpload struct {
+	// URL is the signed upload URL.
+	URL string
+
+	// Bucket is the storage bucket.
+	Bucket string
+
+	// Object is the object path.
+	Object string
+
+	// ContentType is the expected content type. Not checked when empty.
+	ContentType string
+
+	// MD5 is the expected base64 encoded md5 hash. Not checked when empty.
+	MD5 string
+
+	// CRC32C is the expected base64 encoded crc32c checksum. Not checked when
+	// empty.
+	CRC32C string
+
+	// Size is the expected size. Not checked when less than 0.
+	Size int64
+
+	signer *URLSigner
+}
+
+// PendingUpload generates a signed upload URL for the bucket and path,
+// returning a PendingUpload that can later confirm the uploaded object
+// matches the expected content type, md5 hash, and size.
+//
+// When md5 is not empty, it is included in the signature and must be sent by
+// the client as the Content-MD5 header.
+func (u *URLSigner) PendingUpload(bucket, path, contentType, md5 string, size int64) (*PendingUpload, error) {
+	urlstr, err := u.Make(&SigningParams{
+		Method:      "PUT",
+		Hash:        md5,
+		ContentType: contentType,
+		Bucket:      bucket,
+		Object:      path,
+	}, u.defaultExpiration())
+	if err != nil {
+		return nil, err
+	}
+	return &PendingUpload{
+		URL:         urlstr,
+		Bucket:      bucket,
+		Object:      path,
+		ContentType: contentType,
+		MD5:         md5,
+		Size:        size,
+		signer:      u,
+	}, nil
+}
+
+// ConfirmUpload retrieves the uploaded object's attributes using a signed HEAD
+// request, and verifies they match the expected attributes. Returns a
+// *UploadMismatchError when an attribute does not match.
+func (p *PendingUpload) ConfirmUpload(ctx context.Context) error {
+	urlstr, err := p.signer.MakeURL("HEAD", p.Bucket, p.Object, DefaultExpiration, nil)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("HEAD", urlstr, nil)
+	if err != nil {
+		return err
+	}
+	res, err := p.signer.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer drain(res)
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("could not retrieve /%s/%s: %s", strings.Trim(p.Bucket, "/"), strings.TrimPrefix(p.Object, "/"), res.Status)
+	}
+	// determine size
+	size := res.ContentLength
+	if s := res.Header.Get("x-goog-stored-content-length"); s != "" {
+		if size, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return fmt.Errorf("invalid stored content length %q", s)
+		}
+	}
+	for _, v := range []struct {
+		field, expected, actual string
+	}{
+		{"content type", p.ContentType, res.Header.Get("Content-Type")},
+		{"md5", p.MD5, googHash(res.Header, "md5")},
+		{"crc32c", p.CRC32C, googHash(res.Header, "crc32c")},
+	} {
+		if v.expected != "" && v.expected != v.actual {
+			return p.mismatch(v.field, v.expected, v.actual)
+		}
+	}
+	if p.Size >= 0 && p.Size != size {
+		return p.mismatch("size", strconv.FormatInt(p.Size, 10), strconv.FormatInt(size, 10))
+	}
+	return nil
+}
+
+// mismatch returns a UploadMismatchError for the field.
+func (p *PendingUpload) mismatch(field, expected, actual string) error {
+	return &UploadMismatchError{
+		Bucket:   p.Bucket,
+		Object:   p.Object,
+		Field:    field,
+		Expected: expected,
+		Actual:   actual,
+	}
+}
+
+// UploadMismatchError is the error returned when an uploaded object does not
+// match its expected attributes.
+type UploadMismatchError struct {
+	Bucket   string
+	Object   string
+	Field    string
+	Expected string
+	Actual   string
+}
+
+// Error satisfies the error interface.
+func (err *UploadMismatchError) Error() string {
+	return fmt.Sprintf("/%s/%s: %s mismatch: expected %q, got %q", strings.Trim(err.Bucket, "/"), strings.TrimPrefix(err.Object, "/"), err.Field, err.Expected, err.Actual)
+}
@@ -0,0 +1,44 @@
+package gstorage
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// CopyURL creates a signed URL for copying the source object to the
+// destination object, using a PUT request with the x-goog-copy-source header.
+// When srcGeneration is not 0, the specified generation of the source object
+// is copied, using the x-goog-copy-source-generation header, which is
+// included in the signature. The client sends a PUT request with an empty
+// body to the URL, with the returned headers.
+//
+// The source object must be readable under the URLSigner's policies (as a
+// GET request), so that a scoped signer cannot be used to copy objects the
+// client could not otherwise download.
+func (u *URLSigner) CopyURL(srcBucket, srcPath, dstBucket, dstPath string, srcGeneration int64, d time.Duration) (*SignedURL, error) {
+	if srcGeneration < 0 {
+		return nil, fmt.Errorf("invalid source generation %d", srcGeneration)
+	}
+	src := &SigningParams{
+		Method: "GET",
+		Bucket: srcBucket,
+		Object: srcPath,
+	}
+	if err := u.check(src, false); err != nil {
+		return nil, err
+	}
+	headers := http.Header{
+		"x-goog-copy-source": {src.EscapedObjectPath()},
+	}
+	if srcGeneration != 0 {
+		headers["x-goog-copy-source-generation"] = []string{strconv.FormatInt(srcGeneration, 10)}
+	}
+	return u.MakeSigned(&SigningParams{
+		Method:  "PUT",
+		Headers: headers,
+		Bucket:  dstBucket,
+		Object:  dstPath,
+	}, d)
+}
@@ -0,0 +1,89 @@
+package gstorage
+
+import (
+	"crypto/sha256"
+	b64 "encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// CSEKSize is the size of customer-supplied encryption keys (AES-256).
+const CSEKSize = 32
+
+// CSEK is a customer-supplied encryption key, used to encrypt and decrypt
+// objects with keys that are not stored by Google Cloud Storage. Clients
+// must send the encryption key headers (see Headers) with requests for
+// objects encrypted with the key.
+type CSEK struct {
+	key []byte
+}
+
+// NewCSEK creates a customer-supplied encryption key from the raw (not
+// base64 encoded) AES-256 key.
+func NewCSEK(key []byte) (*CSEK, error) {
+	if len(key) != CSEKSize {
+		return nil, fmt.Errorf("invalid encryption key size %d, must be %d bytes", len(key), CSEKSize)
+	}
+	return &CSEK{key: append([]byte(nil), key...)}, nil
+}
+
+// ParseCSEK creates a customer-supplied encryption key from the base64
+// encoded AES-256 key, as used by gsutil's encryption_key setting.
+func ParseCSEK(key string) (*CSEK, error) {
+	buf, err := b64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %v", err)
+	}
+	return NewCSEK(buf)
+}
+
+// GenerateCSEK generates a random customer-supplied encryption key, using
+// the URLSigner's random source.
+func (u *URLSigner) GenerateCSEK() (*CSEK, error) {
+	key := make([]byte, CSEKSize)
+	if _, err := io.ReadFull(u.random(), key); err != nil {
+		return nil, err
+	}
+	return &CSEK{key: key}, nil
+}
+
+// Key returns the base64 encoded key.
+func (k *CSEK) Key() string {
+	return b64.StdEncoding.EncodeToString(k.key)
+}
+
+// KeyHash returns the base64 encoded SHA-256 hash of the key.
+func (k *CSEK) KeyHash() string {
+	h := sha256.Sum256(k.key)
+	return b64.StdEncoding.EncodeToString(h[:])
+}
+
+// Headers returns the encryption headers clients must send with requests for
+// objects encrypted with the key.
+func (k *CSEK) Headers() map[string]string {
+	return map[string]string{
+		"X-Goog-Encryption-Algorithm":  "AES256",
+		"X-Goog-Encryption-Key":        k.Key(),
+		"X-Goog-Encryption-Key-Sha256": k.KeyHash(),
+	}
+}
+
+// Apply adds the encryption headers to the signing params' headers, so they
+// are included in the signing params' required headers (see
+// SigningParams.RequiredHeaders), replacing any existing encryption headers.
+// Only the algorithm header is signed, as the key headers are excluded from
+// signing.
+func (k *CSEK) Apply(p *SigningParams) {
+	headers := make(http.Header, len(p.Headers)+3)
+	for name, v := range p.Headers {
+		if !strings.HasPrefix(strings.ToLower(strings.TrimSpace(name)), "x-goog-encryption-") {
+			headers[name] = v
+		}
+	}
+	for name, v := range k.Headers() {
+		headers[name] = []string{v}
+	}
+	p.Headers = headers
+}
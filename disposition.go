@@ -0,0 +1,55 @@
+package gstorage
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ContentDisposition returns a Content-Disposition value of the disposition
+// type (eg, attachment or inline) for the filename, suitable for both upload
+// headers and the response content disposition override of download URLs
+// (see ResponseHeaders). When the disposition type is empty, attachment is
+// used.
+//
+// The filename parameter is a quoted ASCII fallback, with quotes and
+// backslashes escaped, and control and non-ASCII characters replaced with _.
+// When the filename is not plain ASCII, the RFC 5987 filename* parameter,
+// with the UTF-8 percent-encoded filename, is included, which is preferred by
+// clients supporting it.
+func ContentDisposition(typ, filename string) string {
+	if typ == "" {
+		typ = "attachment"
+	}
+	var fallback, encoded strings.Builder
+	ascii := true
+	for _, c := range filename {
+		switch {
+		case c == '"' || c == '\\':
+			fallback.WriteString(`\` + string(c))
+		case c < ' ' || c > '~':
+			fallback.WriteByte('_')
+			ascii = false
+		default:
+			fallback.WriteRune(c)
+		}
+	}
+	s := typ + `; filename="` + fallback.String() + `"`
+	if ascii {
+		return s
+	}
+	for i := 0; i < len(filename); i++ {
+		if c := filename[i]; isAttrChar(c) {
+			encoded.WriteByte(c)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", c)
+		}
+	}
+	return s + "; filename*=UTF-8''" + encoded.String()
+}
+
+// isAttrChar returns true when c is a RFC 5987 attr-char, which does not need
+// to be percent-encoded.
+func isAttrChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		strings.IndexByte("!#$&+-.^_`|~", c) != -1
+}
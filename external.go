@@ -0,0 +1,381 @@
+package gstorage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultSTSTokenURL is the Security Token Service token exchange URL.
+const DefaultSTSTokenURL = "https://sts.googleapis.com/v1/token"
+
+// cloudPlatformScope is the cloud-platform OAuth2 scope.
+const cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// WithExternalAccountJSON is an option that loads external account
+// (workload identity federation) credentials from a JSON encoded buf, as
+// generated by `gcloud iam workload-identity-pools create-cred-config`.
+//
+// File, URL, and AWS credential sources are supported. The subject token is
+// exchanged with the Security Token Service for a federated access token,
+// which is used to impersonate the credentials' service account. Signing is
+// then done with the IAM Credentials API's signBlob method as the service
+// account, which must have the iam.serviceAccounts.signBlob permission on
+// itself (eg, the Service Account Token Creator role).
+//
+// When the credentials do not have a service_account_impersonation_url, the
+// federated access token is used directly with the signBlob method, signing
+// as the service account set with WithClientEmail. The workload identity
+// pool principal must then have the iam.serviceAccounts.signBlob permission
+// on the service account.
+func WithExternalAccountJSON(buf []byte) Option {
+	return func(u *URLSigner) error {
+		a := new(externalAccount)
+		if err := json.Unmarshal(buf, a); err != nil {
+			return fmt.Errorf("could not decode external account credentials: %v", err)
+		}
+		if a.Type != "external_account" {
+			return fmt.Errorf("invalid external account credentials type %q", a.Type)
+		}
+		if a.Audience == "" || a.SubjectTokenType == "" {
+			return errors.New("external account credentials missing audience or subject_token_type")
+		}
+		if a.TokenURL == "" {
+			a.TokenURL = DefaultSTSTokenURL
+		}
+		a.client = u.client()
+		b := &IAMBackend{
+			TokenSource: a,
+			Client:      u.Client,
+		}
+		u.Backend = b
+		if a.ServiceAccountImpersonationURL == "" {
+			// sign as the client email once all options are applied
+			u.setup = append(u.setup, func(u *URLSigner) error {
+				if u.Backend != b {
+					return nil
+				}
+				if u.ClientEmail == "" {
+					return errors.New("external account credentials without service_account_impersonation_url require a client email (see WithClientEmail)")
+				}
+				b.ServiceAccount = u.ClientEmail
+				return nil
+			})
+			return nil
+		}
+		// determine service account from impersonation url
+		const prefix, suffix = "/serviceAccounts/", ":generateAccessToken"
+		i, j := strings.LastIndex(a.ServiceAccountImpersonationURL, prefix), strings.LastIndex(a.ServiceAccountImpersonationURL, suffix)
+		if i == -1 || j < i {
+			return errors.New("external account credentials has an invalid service_account_impersonation_url")
+		}
+		email, err := url.PathUnescape(a.ServiceAccountImpersonationURL[i+len(prefix) : j])
+		if err != nil {
+			return fmt.Errorf("invalid service_account_impersonation_url: %v", err)
+		}
+		u.ClientEmail, b.ServiceAccount = email, email
+		return nil
+	}
+}
+
+// externalAccount is a workload identity federation token source.
+type externalAccount struct {
+	Type                           string `json:"type"`
+	Audience                       string `json:"audience"`
+	SubjectTokenType               string `json:"subject_token_type"`
+	TokenURL                       string `json:"token_url"`
+	ServiceAccountImpersonationURL string `json:"service_account_impersonation_url"`
+	CredentialSource               struct {
+		File    string            `json:"file"`
+		URL     string            `json:"url"`
+		Headers map[string]string `json:"headers"`
+		Format  struct {
+			Type                  string `json:"type"`
+			SubjectTokenFieldName string `json:"subject_token_field_name"`
+		} `json:"format"`
+		EnvironmentID               string `json:"environment_id"`
+		RegionURL                   string `json:"region_url"`
+		RegionalCredVerificationURL string `json:"regional_cred_verification_url"`
+		IMDSv2SessionTokenURL       string `json:"imdsv2_session_token_url"`
+	} `json:"credential_source"`
+
+	client *http.Client
+	tokens tokenCache
+}
+
+// AccessToken satisfies the TokenSource interface, returning an access
+// token for the impersonated service account, or the federated access token
+// when the credentials do not impersonate a service account.
+func (a *externalAccount) AccessToken(ctx context.Context) (string, error) {
+	return a.tokens.get(ctx, func(ctx context.Context) (string, time.Time, error) {
+		subjectToken, err := a.subjectToken(ctx)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		// exchange subject token
+		req, err := http.NewRequest("POST", a.TokenURL, strings.NewReader(url.Values{
+			"grant_type":           {"urn:ietf:params:oauth:grant-type:token-exchange"},
+			"audience":             {a.Audience},
+			"scope":                {cloudPlatformScope},
+			"requested_token_type": {"urn:ietf:params:oauth:token-type:access_token"},
+			"subject_token":        {subjectToken},
+			"subject_token_type":   {a.SubjectTokenType},
+		}.Encode()))
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		var sts tokenResponse
+		if err := doJSON(a.client, req.WithContext(ctx), &sts); err != nil {
+			return "", time.Time{}, fmt.Errorf("could not exchange subject token: %v", err)
+		}
+		if a.ServiceAccountImpersonationURL == "" {
+			return sts.AccessToken, time.Now().Add(time.Duration(sts.ExpiresIn) * time.Second), nil
+		}
+		// impersonate service account
+		body, err := json.Marshal(map[string]interface{}{
+			"scope":    []string{cloudPlatformScope},
+			"lifetime": "3600s",
+		})
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		if req, err = http.NewRequest("POST", a.ServiceAccountImpersonationURL, bytes.NewReader(body)); err != nil {
+			return "", time.Time{}, err
+		}
+		req.Header.Set("Authorization", "Bearer "+sts.AccessToken)
+		req.Header.Set("Content-Type", "application/json")
+		var res struct {
+			AccessToken string    `json:"accessToken"`
+			ExpireTime  time.Time `json:"expireTime"`
+		}
+		if err := doJSON(a.client, req.WithContext(ctx), &res); err != nil {
+			return "", time.Time{}, fmt.Errorf("could not impersonate service account: %v", err)
+		}
+		return res.AccessToken, res.ExpireTime, nil
+	})
+}
+
+// subjectToken retrieves the subject token from the credential source.
+func (a *externalAccount) subjectToken(ctx context.Context) (string, error) {
+	src := a.CredentialSource
+	var buf []byte
+	switch {
+	case strings.HasPrefix(src.EnvironmentID, "aws"):
+		return a.awsSubjectToken(ctx)
+	case src.EnvironmentID != "":
+		return "", fmt.Errorf("unsupported credential source environment %q", src.EnvironmentID)
+	case src.File != "":
+		var err error
+		if buf, err = ioutil.ReadFile(src.File); err != nil {
+			return "", fmt.Errorf("could not read subject token file: %v", err)
+		}
+	case src.URL != "":
+		req, err := http.NewRequest("GET", src.URL, nil)
+		if err != nil {
+			return "", err
+		}
+		for k, v := range src.Headers {
+			req.Header.Set(k, v)
+		}
+		if buf, err = a.get(ctx, req); err != nil {
+			return "", fmt.Errorf("could not retrieve subject token: %v", err)
+		}
+	default:
+		return "", errors.New("external account credentials missing credential_source")
+	}
+	switch src.Format.Type {
+	case "", "text":
+		return strings.TrimSpace(string(buf)), nil
+	case "json":
+		var v map[string]interface{}
+		if err := json.Unmarshal(buf, &v); err != nil {
+			return "", fmt.Errorf("could not decode subject token: %v", err)
+		}
+		tok, ok := v[src.Format.SubjectTokenFieldName].(string)
+		if !ok || tok == "" {
+			return "", fmt.Errorf("subject token missing field %q", src.Format.SubjectTokenFieldName)
+		}
+		return tok, nil
+	}
+	return "", fmt.Errorf("unsupported subject token format %q", src.Format.Type)
+}
+
+// awsSubjectToken builds a subject token from a signed AWS GetCallerIdentity
+// request.
+func (a *externalAccount) awsSubjectToken(ctx context.Context) (string, error) {
+	src := a.CredentialSource
+	if src.RegionalCredVerificationURL == "" {
+		return "", errors.New("aws credential source missing regional_cred_verification_url")
+	}
+	// imdsv2 session token
+	var imdsToken string
+	if src.IMDSv2SessionTokenURL != "" {
+		req, err := http.NewRequest("PUT", src.IMDSv2SessionTokenURL, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "300")
+		buf, err := a.get(ctx, req)
+		if err != nil {
+			return "", fmt.Errorf("could not retrieve aws session token: %v", err)
+		}
+		imdsToken = string(buf)
+	}
+	imds := func(urlstr string) (string, error) {
+		req, err := http.NewRequest("GET", urlstr, nil)
+		if err != nil {
+			return "", err
+		}
+		if imdsToken != "" {
+			req.Header.Set("X-aws-ec2-metadata-token", imdsToken)
+		}
+		buf, err := a.get(ctx, req)
+		return strings.TrimSpace(string(buf)), err
+	}
+	// region
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		if src.RegionURL == "" {
+			return "", errors.New("aws credential source missing region_url")
+		}
+		zone, err := imds(src.RegionURL)
+		if err != nil || zone == "" {
+			return "", fmt.Errorf("could not retrieve aws region: %v", err)
+		}
+		// strip availability zone letter
+		region = zone[:len(zone)-1]
+	}
+	// security credentials
+	keyID, secret, session := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN")
+	if keyID == "" || secret == "" {
+		if src.URL == "" {
+			return "", errors.New("aws credential source missing url")
+		}
+		role, err := imds(src.URL)
+		if err != nil {
+			return "", fmt.Errorf("could not retrieve aws role: %v", err)
+		}
+		buf, err := imds(strings.TrimSuffix(src.URL, "/") + "/" + role)
+		if err != nil {
+			return "", fmt.Errorf("could not retrieve aws credentials: %v", err)
+		}
+		var v struct {
+			AccessKeyID     string `json:"AccessKeyId"`
+			SecretAccessKey string `json:"SecretAccessKey"`
+			Token           string `json:"Token"`
+		}
+		if err := json.Unmarshal([]byte(buf), &v); err != nil {
+			return "", fmt.Errorf("could not decode aws credentials: %v", err)
+		}
+		keyID, secret, session = v.AccessKeyID, v.SecretAccessKey, v.Token
+	}
+	// sign GetCallerIdentity request
+	urlstr := strings.Replace(src.RegionalCredVerificationURL, "{region}", region, -1)
+	u, err := url.Parse(urlstr)
+	if err != nil {
+		return "", fmt.Errorf("invalid regional_cred_verification_url: %v", err)
+	}
+	headers := map[string]string{
+		"host":                         u.Host,
+		"x-amz-date":                   time.Now().UTC().Format("20060102T150405Z"),
+		"x-goog-cloud-target-resource": a.Audience,
+	}
+	if session != "" {
+		headers["x-amz-security-token"] = session
+	}
+	headers["Authorization"] = awsSigV4("POST", u, headers, region, "sts", keyID, secret)
+	// encode subject token
+	type header struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	}
+	var keys []string
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	v := struct {
+		URL     string   `json:"url"`
+		Method  string   `json:"method"`
+		Headers []header `json:"headers"`
+	}{URL: urlstr, Method: "POST"}
+	for _, k := range keys {
+		v.Headers = append(v.Headers, header{k, headers[k]})
+	}
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return url.QueryEscape(string(buf)), nil
+}
+
+// get performs the request, returning the response body.
+func (a *externalAccount) get(ctx context.Context, req *http.Request) ([]byte, error) {
+	res, err := a.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer drain(res)
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s: %s", req.Method, req.URL.Host, res.Status)
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
+// awsSigV4 returns the AWS Signature Version 4 authorization header for an
+// empty bodied request.
+func awsSigV4(method string, u *url.URL, headers map[string]string, region, service, keyID, secret string) string {
+	amzDate := headers["x-amz-date"]
+	date := amzDate[:8]
+	// canonical headers
+	var keys []string
+	for k := range headers {
+		keys = append(keys, strings.ToLower(k))
+	}
+	sort.Strings(keys)
+	var canonicalHeaders strings.Builder
+	for _, k := range keys {
+		canonicalHeaders.WriteString(k + ":" + strings.TrimSpace(headers[k]) + "\n")
+	}
+	signedHeaders := strings.Join(keys, ";")
+	// canonical request
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	payload := sha256.Sum256(nil)
+	canonicalRequest := method + "\n" +
+		path + "\n" +
+		canonicalQuery(u.Query()) + "\n" +
+		canonicalHeaders.String() + "\n" +
+		signedHeaders + "\n" +
+		hex.EncodeToString(payload[:])
+	// string to sign
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	h := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(h[:])
+	// signing key
+	key := []byte("AWS4" + secret)
+	for _, s := range []string{date, region, service, "aws4_request", stringToSign} {
+		mac := hmac.New(sha256.New, key)
+		_, _ = mac.Write([]byte(s))
+		key = mac.Sum(nil)
+	}
+	return "AWS4-HMAC-SHA256 Credential=" + keyID + "/" + scope + ", SignedHeaders=" + signedHeaders + ", Signature=" + hex.EncodeToString(key)
+}
@@ -0,0 +1,165 @@
+package gstorage
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAWSSigV4(t *testing.T) {
+	// the first three vectors are from the AWS Signature Version 4 test suite
+	// (get-vanilla, post-vanilla, and get-vanilla-query-order-key-case), the
+	// last is a GetCallerIdentity request as signed for a subject token
+	const keyID, secret = "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	tests := []struct {
+		method  string
+		urlstr  string
+		headers map[string]string
+		region  string
+		service string
+		exp     string
+	}{
+		{
+			"GET", "https://example.amazonaws.com",
+			map[string]string{"host": "example.amazonaws.com", "x-amz-date": "20150830T123600Z"},
+			"us-east-1", "service",
+			"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			"POST", "https://example.amazonaws.com/",
+			map[string]string{"host": "example.amazonaws.com", "x-amz-date": "20150830T123600Z"},
+			"us-east-1", "service",
+			"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+		{
+			"GET", "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			map[string]string{"host": "example.amazonaws.com", "x-amz-date": "20150830T123600Z"},
+			"us-east-1", "service",
+			"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+		{
+			"POST", "https://sts.us-east-2.amazonaws.com?Action=GetCallerIdentity&Version=2011-06-15",
+			map[string]string{
+				"host":                         "sts.us-east-2.amazonaws.com",
+				"x-amz-date":                   "20200811T065522Z",
+				"x-amz-security-token":         "sessiontoken",
+				"x-goog-cloud-target-resource": "//iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/pool/providers/aws",
+			},
+			"us-east-2", "sts",
+			"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20200811/us-east-2/sts/aws4_request, SignedHeaders=host;x-amz-date;x-amz-security-token;x-goog-cloud-target-resource, Signature=776f4dc84e5574e5b534ac2e57d589fe4e9fa8c95d1d0e0fe792705a1fb71777",
+		},
+	}
+	for i, test := range tests {
+		u, err := url.Parse(test.urlstr)
+		if err != nil {
+			t.Fatalf("test %d expected no error, got: %v", i, err)
+		}
+		if s := awsSigV4(test.method, u, test.headers, test.region, test.service, keyID, secret); s != test.exp {
+			t.Errorf("test %d expected:\n%s\ngot:\n%s", i, test.exp, s)
+		}
+	}
+}
+
+// newTestSTSServer starts a fake Security Token Service and IAM Credentials
+// generateAccessToken endpoint.
+func newTestSTSServer(t *testing.T, subjectToken string) *httptest.Server {
+	t.Helper()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case req.URL.Path == "/v1/token":
+			if req.FormValue("subject_token") != subjectToken {
+				http.Error(w, "invalid subject token", http.StatusUnauthorized)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"access_token": "federated-token",
+				"token_type":   "Bearer",
+				"expires_in":   3600,
+			})
+		case strings.HasSuffix(req.URL.Path, ":generateAccessToken"):
+			if req.Header.Get("Authorization") != "Bearer federated-token" {
+				http.Error(w, "invalid token", http.StatusUnauthorized)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"accessToken": "impersonated-token",
+				"expireTime":  "2100-01-01T00:00:00Z",
+			})
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestWithExternalAccountJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gstorage")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("subject-token\n"), 0600); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	s := newTestSTSServer(t, "subject-token")
+	const email = "sa@project.iam.gserviceaccount.com"
+	creds := func(impersonationURL string) []byte {
+		buf, err := json.Marshal(map[string]interface{}{
+			"type":                              "external_account",
+			"audience":                          "//iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/pool/providers/oidc",
+			"subject_token_type":                "urn:ietf:params:oauth:token-type:jwt",
+			"token_url":                         s.URL + "/v1/token",
+			"service_account_impersonation_url": impersonationURL,
+			"credential_source":                 map[string]string{"file": tokenFile},
+		})
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		return buf
+	}
+	tests := []struct {
+		buf   []byte
+		opts  []Option
+		email string
+		token string
+	}{
+		{creds(s.URL + "/v1/projects/-/serviceAccounts/" + email + ":generateAccessToken"), nil, email, "impersonated-token"},
+		{creds(""), []Option{WithClientEmail(email)}, email, "federated-token"},
+		{creds(""), nil, "", ""},
+	}
+	for i, test := range tests {
+		u, err := NewURLSigner(append([]Option{WithExternalAccountJSON(test.buf)}, test.opts...)...)
+		switch {
+		case test.email == "" && err == nil:
+			t.Fatalf("test %d expected error", i)
+		case test.email == "":
+			continue
+		case err != nil:
+			t.Fatalf("test %d expected no error, got: %v", i, err)
+		}
+		b, ok := u.Backend.(*IAMBackend)
+		if !ok {
+			t.Fatalf("test %d expected *IAMBackend, got: %T", i, u.Backend)
+		}
+		if u.ClientEmail != test.email || b.ServiceAccount != test.email {
+			t.Errorf("test %d expected client email and service account %q, got: %q, %q", i, test.email, u.ClientEmail, b.ServiceAccount)
+		}
+		tok, err := b.TokenSource.AccessToken(context.Background())
+		if err != nil {
+			t.Fatalf("test %d expected no error, got: %v", i, err)
+		}
+		if tok != test.token {
+			t.Errorf("test %d expected token %q, got: %q", i, test.token, tok)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package gstorage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Failover defaults.
+const (
+	// DefaultFailoverThreshold is the default number of consecutive primary
+	// backend failures before failing over to the secondary backend.
+	DefaultFailoverThreshold = 3
+
+	// DefaultRecoveryInterval is the default interval between attempts to
+	// recover to the primary backend after failing over.
+	DefaultRecoveryInterval = 1 * time.Minute
+)
+
+// FailoverBackend is a signing backend that prefers a primary backend (such
+// as an IAMBackend), and fails over to a warm standby secondary backend (such
+// as a local key loaded with WithSecretManagerKey) when the primary backend
+// fails repeatedly.
+//
+// Requests failing on the primary backend are retried with the secondary
+// backend. After Threshold consecutive primary failures, requests are sent
+// directly to the secondary backend, and the primary backend is retried once
+// per RecoveryInterval, switching back after a successful request.
+type FailoverBackend struct {
+	// Primary is the primary backend.
+	Primary Backend
+
+	// Secondary is the secondary backend.
+	Secondary Backend
+
+	// Threshold is the number of consecutive primary failures before failing
+	// over. If not supplied, then DefaultFailoverThreshold will be used
+	// instead.
+	Threshold int
+
+	// RecoveryInterval is the interval between attempts to recover to the
+	// primary backend. If not supplied, then DefaultRecoveryInterval will be
+	// used instead.
+	RecoveryInterval time.Duration
+
+	mu       sync.Mutex
+	failures int
+	failed   bool
+	retry    time.Time
+	stats    FailoverStats
+}
+
+// FailoverStats are the statistics for a FailoverBackend.
+type FailoverStats struct {
+	// PrimarySuccesses is the number of successful primary signatures.
+	PrimarySuccesses int64
+
+	// PrimaryFailures is the number of failed primary signatures.
+	PrimaryFailures int64
+
+	// SecondarySuccesses is the number of successful secondary signatures.
+	SecondarySuccesses int64
+
+	// SecondaryFailures is the number of failed secondary signatures.
+	SecondaryFailures int64
+
+	// Failovers is the number of failovers to the secondary backend.
+	Failovers int64
+
+	// Recoveries is the number of recoveries to the primary backend.
+	Recoveries int64
+
+	// FailedOver indicates the secondary backend is active.
+	FailedOver bool
+}
+
+// SignBytes satisfies the Backend interface.
+func (f *FailoverBackend) SignBytes(ctx context.Context, buf []byte) ([]byte, error) {
+	if f.Primary == nil || f.Secondary == nil {
+		return nil, errors.New("failover backend missing primary or secondary backend")
+	}
+	if f.usePrimary() {
+		sig, err := f.Primary.SignBytes(ctx, buf)
+		f.primaryResult(err)
+		if err == nil {
+			return sig, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	sig, err := f.Secondary.SignBytes(ctx, buf)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err != nil {
+		f.stats.SecondaryFailures++
+		return nil, err
+	}
+	f.stats.SecondarySuccesses++
+	return sig, nil
+}
+
+// Stats returns the failover backend's statistics.
+func (f *FailoverBackend) Stats() FailoverStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stats := f.stats
+	stats.FailedOver = f.failed
+	return stats
+}
+
+// usePrimary returns whether the primary backend should be used for the
+// next request.
+func (f *FailoverBackend) usePrimary() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.failed {
+		return true
+	}
+	if now := time.Now(); !now.Before(f.retry) {
+		// allow a single recovery attempt per interval
+		f.retry = now.Add(f.recoveryInterval())
+		return true
+	}
+	return false
+}
+
+// primaryResult records the result of a primary backend request.
+func (f *FailoverBackend) primaryResult(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err == nil {
+		f.stats.PrimarySuccesses++
+		if f.failed {
+			f.stats.Recoveries++
+		}
+		f.failures, f.failed = 0, false
+		return
+	}
+	f.stats.PrimaryFailures++
+	f.failures++
+	threshold := f.Threshold
+	if threshold <= 0 {
+		threshold = DefaultFailoverThreshold
+	}
+	if !f.failed && f.failures >= threshold {
+		f.stats.Failovers++
+		f.failed, f.retry = true, time.Now().Add(f.recoveryInterval())
+	}
+}
+
+// recoveryInterval returns the recovery interval.
+func (f *FailoverBackend) recoveryInterval() time.Duration {
+	if f.RecoveryInterval != 0 {
+		return f.RecoveryInterval
+	}
+	return DefaultRecoveryInterval
+}
@@ -0,0 +1,111 @@
+package gstorage
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultFallbackCooldown is the default duration a failed backend is skipped
+// by a FallbackBackend.
+const DefaultFallbackCooldown = 30 * time.Second
+
+// FallbackBackend is a signing backend that signs using the first of its
+// backends (in priority order) that succeeds.
+//
+// Backends that fail are marked unhealthy and are skipped for the cooldown
+// period, so that an outage of a preferred backend does not delay every
+// signature. When all backends are unhealthy, all backends are tried.
+type FallbackBackend struct {
+	// Cooldown is the duration a failed backend is skipped. If not supplied,
+	// then DefaultFallbackCooldown will be used instead.
+	Cooldown time.Duration
+
+	backends []Backend
+
+	mu    sync.Mutex
+	until []time.Time
+}
+
+// NewFallbackBackend creates a new fallback backend for the backends, in
+// priority order.
+func NewFallbackBackend(backends ...Backend) *FallbackBackend {
+	return &FallbackBackend{
+		backends: backends,
+		until:    make([]time.Time, len(backends)),
+	}
+}
+
+// NewSignerBackend creates a signing backend for a local private key, for use
+// with a FallbackBackend.
+func NewSignerBackend(key crypto.Signer) Backend {
+	return newKeyBackend(key, "")
+}
+
+// SignBytes satisfies the Backend interface.
+func (f *FallbackBackend) SignBytes(ctx context.Context, buf []byte) ([]byte, error) {
+	if len(f.backends) == 0 {
+		return nil, errors.New("fallback backend has no backends")
+	}
+	var err error
+	for _, i := range f.order() {
+		var sig []byte
+		if sig, err = f.backends[i].SignBytes(ctx, buf); err == nil {
+			f.mark(i, true)
+			return sig, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		f.mark(i, false)
+	}
+	return nil, fmt.Errorf("all signing backends failed: %v", err)
+}
+
+// Healthy returns whether each of the backends is healthy.
+func (f *FallbackBackend) Healthy() []bool {
+	now := time.Now()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	healthy := make([]bool, len(f.until))
+	for i, t := range f.until {
+		healthy[i] = !now.Before(t)
+	}
+	return healthy
+}
+
+// order returns the indexes of the backends to try, with healthy backends
+// first.
+func (f *FallbackBackend) order() []int {
+	healthy := f.Healthy()
+	order := make([]int, 0, len(healthy))
+	for i, ok := range healthy {
+		if ok {
+			order = append(order, i)
+		}
+	}
+	for i, ok := range healthy {
+		if !ok {
+			order = append(order, i)
+		}
+	}
+	return order
+}
+
+// mark marks the backend as healthy or unhealthy.
+func (f *FallbackBackend) mark(i int, healthy bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if healthy {
+		f.until[i] = time.Time{}
+		return
+	}
+	cooldown := f.Cooldown
+	if cooldown == 0 {
+		cooldown = DefaultFallbackCooldown
+	}
+	f.until[i] = time.Now().Add(cooldown)
+}
@@ -1,12 +1,21 @@
 package gstorage
 
 import (
+	"context"
 	"crypto"
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/rsa"
+	_ "crypto/sha1"   // sha1 hash
+	_ "crypto/sha256" // sha256 hash
+	_ "crypto/sha512" // sha384 and sha512 hashes
 	b64 "encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
 	"net/url"
-	"sort"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -16,69 +25,341 @@ const (
 	// DefaultBaseURL is the base Google Storage URL.
 	DefaultBaseURL = "https://storage.googleapis.com"
 
-	// DefaultExpiration is the default expiration for signed URLs.
+	// RestrictedBaseURL is the base Google Storage URL for the restricted
+	// VIP, used in VPC Service Controls environments.
+	RestrictedBaseURL = "https://restricted.googleapis.com"
+
+	// PrivateBaseURL is the base Google Storage URL for the private VIP, used
+	// with Private Google Access.
+	PrivateBaseURL = "https://private.googleapis.com"
+
+	// DefaultExpiration is the default expiration for signed URLs, used when
+	// the URLSigner does not have a default expiration. See
+	// WithDefaultExpiration.
 	DefaultExpiration = 1 * time.Hour
+
+	// DefaultSignatureHash is the default hash used for generating signature
+	// digests.
+	DefaultSignatureHash = crypto.SHA256
+
+	// DefaultMinRSAKeyBits is the default minimum size of RSA private keys.
+	DefaultMinRSAKeyBits = 2048
 )
 
+// Error values.
+var (
+	// ErrMissingPrivateKey is the missing private key error.
+	ErrMissingPrivateKey = errors.New("missing private key")
+
+	// ErrMissingClientEmail is the missing client email error.
+	ErrMissingClientEmail = errors.New("missing client email")
+
+	// ErrExpired is the expired error, wrapped by errors for expirations
+	// that are not in the future, and for expired signatures.
+	ErrExpired = errors.New("expired")
+
+	// ErrInvalidMethod is the invalid method error, wrapped by method
+	// validation errors.
+	ErrInvalidMethod = errors.New("invalid method")
+
+	// ErrInvalidBucket is the invalid bucket error, wrapped by bucket name
+	// validation errors.
+	ErrInvalidBucket = errors.New("invalid bucket")
+
+	// ErrInvalidObject is the invalid object error, wrapped by object name
+	// validation errors.
+	ErrInvalidObject = errors.New("invalid object")
+)
+
+// SignError is the error returned when the URLSigner's private key, signer,
+// or backend fails to generate a signature.
+type SignError struct {
+	// Backend describes what generated the signature, either private key, or
+	// the type of the signer or backend (eg, *gstorage.IAMBackend).
+	Backend string
+
+	// Cause is the underlying error.
+	Cause error
+}
+
+// Error satisfies the error interface.
+func (err *SignError) Error() string {
+	return fmt.Sprintf("%s: %v", err.Backend, err.Cause)
+}
+
+// Unwrap returns the underlying error.
+func (err *SignError) Unwrap() error {
+	return err.Cause
+}
+
+// wrappedError is an error with a message, that wraps an error value (eg,
+// ErrExpired) for use with errors.Is.
+type wrappedError struct {
+	msg string
+	err error
+}
+
+// Error satisfies the error interface.
+func (err *wrappedError) Error() string {
+	return err.msg
+}
+
+// Unwrap returns the wrapped error value.
+func (err *wrappedError) Unwrap() error {
+	return err.err
+}
+
 // SigningParams are the signing params for generating a signed URL.
 type SigningParams struct {
-	// BaseURL is the URL to use for building the URL. If not supplied, then
-	// DefaultBaseURL will be used instead.
-	BaseURL string
+	// BaseURL is the base URL to use for building the URL. If not supplied,
+	// then the URLSigner's BaseURL will be used instead.
+	BaseURL *url.URL
 
-	// Method is the HTTP method (GET, PUT, ...).
+	// Method is the HTTP method (GET, PUT, ...). See Method.
 	Method string
 
 	// Hash is the md5 hash of the file content for an upload.
 	Hash string
 
+	// CRC32C is the base64 encoded crc32c checksum of the file content for an
+	// upload (see CRC32C), which is signed as the x-goog-hash header, so that
+	// Google Cloud Storage rejects uploads with differing content. Unlike md5
+	// hashes, crc32c checksums are available for composite objects.
+	CRC32C string
+
 	// ContentType is the content type of the uploaded file.
 	ContentType string
 
 	// Expiration is the expiration time of a generated signature.
 	Expiration time.Time
 
-	// Headers are the extra headers.
-	Headers map[string]string
+	// TTL is the duration a generated signature is valid for, from the time
+	// of signing. When not 0, the TTL overrides the expiration, and is itself
+	// overridden by a duration passed to Make (or similar).
+	TTL time.Duration
+
+	// NotBefore is the time before which a generated URL is not valid. As
+	// Google Cloud Storage signatures cannot express a start time, URLs with
+	// NotBefore set are made using the URLSigner's CDN signer. See
+	// WithCDNFallback.
+	NotBefore time.Time
+
+	// Headers are the extra headers, such as headers captured from a
+	// http.Request. Header names are case-insensitive, and need not be
+	// canonical. Multiple values of a header, including values of headers
+	// differing only by case, are combined into a comma separated list when
+	// signing.
+	Headers http.Header
 
 	// Bucket is the storage bucket.
 	Bucket string
 
-	// Object is the object path.
+	// Object is the object path. When empty, the signing params are for a
+	// bucket-level request (eg, listing objects), having the canonical path
+	// /<bucket>/.
+	//
+	// A single leading slash is removed, while trailing slashes are
+	// preserved, so that zero-byte folder placeholder objects (eg, dir/) can
+	// be signed.
 	Object string
+
+	// BucketBoundHostname is a custom domain (CNAME) bound to the bucket, such
+	// as assets.example.com, used as the host of generated URLs instead of the
+	// base URL. For V2 signatures, the canonical resource retains the bucket
+	// (which must be named the same as the domain), while V4 signatures sign
+	// the hostname as the host header and omit the bucket from the path.
+	BucketBoundHostname string
+
+	// ExtraQuery are extra query parameters added to the generated URL, such
+	// as analytics tags or cache busters, that are not part of the request's
+	// semantics. Extra query parameters are not signed with V2 signatures,
+	// but, as V4 signatures cover all query parameters, are signed with V4
+	// signatures. Extra query parameters cannot use the names of signed or
+	// reserved parameters.
+	ExtraQuery url.Values
+
+	// Response are the response header overrides for download URLs, which are
+	// added to the generated URL's query, and signed with V4 signatures.
+	Response ResponseHeaders
+
+	// Subresource is the XML API subresource (acl, cors, lifecycle, uploads,
+	// compose, ...), optionally with a value (eg, uploadId=...). Subresources
+	// are included in the signature and the generated URL's query.
+	Subresource string
+}
+
+// checkExtraQuery checks the extra query parameters do not use the names of
+// signed or reserved parameters.
+func (p SigningParams) checkExtraQuery() error {
+	if len(p.ExtraQuery) == 0 {
+		return nil
+	}
+	reserved := url.Values{}
+	p.Response.query(reserved)
+	if s := strings.TrimPrefix(p.Subresource, "?"); s != "" {
+		v, err := url.ParseQuery(s)
+		if err != nil {
+			return fmt.Errorf("invalid subresource %q: %v", p.Subresource, err)
+		}
+		for k := range v {
+			reserved[k] = nil
+		}
+	}
+	for k := range p.ExtraQuery {
+		l := strings.ToLower(k)
+		_, ok := reserved[k]
+		switch {
+		case ok,
+			l == "googleaccessid", l == "expires", l == "signature",
+			strings.HasPrefix(l, "x-goog-"), strings.HasPrefix(l, "response-"):
+			return fmt.Errorf("extra query parameter %q is reserved", k)
+		}
+	}
+	return nil
+}
+
+// ResponseHeaders are response header overrides for download URLs, that
+// override the object's metadata for a single request, such as for localized
+// delivery of an object.
+type ResponseHeaders struct {
+	// ContentType overrides the Content-Type response header.
+	ContentType string `json:"content_type,omitempty"`
+
+	// ContentDisposition overrides the Content-Disposition response header.
+	ContentDisposition string `json:"content_disposition,omitempty"`
+
+	// ContentLanguage overrides the Content-Language response header.
+	ContentLanguage string `json:"content_language,omitempty"`
+
+	// ContentEncoding overrides the Content-Encoding response header.
+	ContentEncoding string `json:"content_encoding,omitempty"`
+
+	// CacheControl overrides the Cache-Control response header.
+	CacheControl string `json:"cache_control,omitempty"`
+}
+
+// query adds the response header override query parameters to v.
+func (r ResponseHeaders) query(v url.Values) {
+	for _, z := range []struct {
+		name, value string
+	}{
+		{"response-content-type", r.ContentType},
+		{"response-content-disposition", r.ContentDisposition},
+		{"response-content-language", r.ContentLanguage},
+		{"response-content-encoding", r.ContentEncoding},
+		{"response-cache-control", r.CacheControl},
+	} {
+		if z.value != "" {
+			v.Set(z.name, z.value)
+		}
+	}
 }
 
 // HeaderString sorts the headers in order, returning an ordered, usable string
 // for use with signing.
+//
+// Header names are lowercased and trimmed, values are trimmed with internal
+// runs of whitespace folded to a single space, multiple values of a header
+// (including values of headers differing only by case) are combined into a
+// comma separated list, and headers with empty names, along with the
+// customer-supplied encryption key headers, are excluded.
+//
+// As the V2 canonical extension headers, only x-goog-* headers are included.
+// Other headers (eg, Cache-Control) are not signed by V2 signatures, but
+// are still sent by clients (see RequiredHeaders).
 func (p SigningParams) HeaderString() string {
-	h := make([]string, len(p.Headers))
-	headers := make(map[string]string)
-	var i int
-	for k, v := range p.Headers {
-		k = strings.TrimSpace(strings.ToLower(k))
-		if k != "x-goog-encryption-key" && k != "x-goog-encryption-key-sha256" {
-			headers[k] = v
-			h[i] = k
+	headers := p.headers()
+	n := 0
+	for _, h := range headers {
+		if isExtensionHeader(h.name) {
+			n += len(h.name) + len(h.value) + 2
 		}
-		i++
 	}
-	if len(h) != 0 {
-		sort.Slice(h, func(i, j int) bool {
-			return strings.Compare(h[i], h[j]) < 0
-		})
-		for i, k := range h {
-			h[i] += ":" + strings.TrimSpace(headers[k])
+	var sb strings.Builder
+	sb.Grow(n)
+	for _, h := range headers {
+		if !isExtensionHeader(h.name) {
+			continue
 		}
-		return strings.Join(h, "\n") + "\n"
+		sb.WriteString(h.name)
+		sb.WriteByte(':')
+		sb.WriteString(h.value)
+		sb.WriteByte('\n')
 	}
-	return ""
+	return sb.String()
+}
+
+// RequiredHeaders returns the headers a client must send with requests using
+// URLs signed with the signing params, including the content type, md5 hash,
+// and crc32c checksum (as the X-Goog-Hash header) (if any), with canonical
+// names (see http.CanonicalHeaderKey) and
+// trimmed values. Multiple values of a header are combined, as they are when
+// signing.
+func (p SigningParams) RequiredHeaders() map[string]string {
+	h := make(map[string]string)
+	if p.ContentType != "" {
+		h["Content-Type"] = p.ContentType
+	}
+	if p.Hash != "" {
+		h["Content-MD5"] = p.Hash
+	}
+	for _, z := range p.headers() {
+		h[http.CanonicalHeaderKey(z.name)] = z.value
+	}
+	// encryption key headers are not signed, but must still be sent
+	for k, v := range p.Headers {
+		switch k = http.CanonicalHeaderKey(strings.TrimSpace(k)); k {
+		case "X-Goog-Encryption-Key", "X-Goog-Encryption-Key-Sha256":
+			if len(v) != 0 {
+				h[k] = strings.TrimSpace(v[0])
+			}
+		}
+	}
+	return h
+}
+
+// headers returns the canonical headers of the signing params, sorted by
+// name, including the x-goog-hash header for the crc32c checksum (if any).
+// See canonicalHeaders.
+func (p SigningParams) headers() []header {
+	if p.CRC32C == "" {
+		return canonicalHeaders(p.Headers)
+	}
+	headers := make(http.Header, len(p.Headers)+1)
+	for k, v := range p.Headers {
+		headers[k] = v
+	}
+	headers["x-goog-hash"] = append(append([]string(nil), headers["x-goog-hash"]...), "crc32c="+p.CRC32C)
+	return canonicalHeaders(headers)
 }
 
-// ObjectPath returns the canonical path.
+// ObjectPath returns the canonical path, /<bucket>/<object>, or /<bucket>/
+// for bucket-level requests.
 func (p SigningParams) ObjectPath() string {
 	return "/" + strings.Trim(p.Bucket, "/") + "/" + strings.TrimPrefix(p.Object, "/")
 }
 
+// EscapedObjectPath returns the canonical path, escaped for use in a URL.
+// Object names containing spaces, #, ?, %, and non-ASCII characters are
+// percent-encoded, as Google Cloud Storage expects.
+func (p SigningParams) EscapedObjectPath() string {
+	return escapePath(p.ObjectPath())
+}
+
+// CanonicalResource returns the canonical resource, which is the escaped
+// canonical path followed by the subresource (if any).
+func (p SigningParams) CanonicalResource() string {
+	if s := strings.TrimPrefix(p.Subresource, "?"); s != "" {
+		return p.EscapedObjectPath() + "?" + s
+	}
+	return p.EscapedObjectPath()
+}
+
+// escapePath escapes the path for use in a URL.
+func escapePath(path string) string {
+	return (&url.URL{Path: path}).EscapedPath()
+}
+
 // String satisfies stringer returning the formatted string suitable for use
 // with the URLSigner.
 func (p SigningParams) String() string {
@@ -87,7 +368,18 @@ func (p SigningParams) String() string {
 		p.ContentType + "\n" +
 		strconv.FormatInt(p.Expiration.Unix(), 10) + "\n" +
 		p.HeaderString() +
-		p.ObjectPath()
+		p.CanonicalResource()
+}
+
+// Digest returns the digest of the string to sign for the signing params,
+// using the hash.
+//
+// Note that the digest does not include a URLSigner's default headers, name
+// normalization, or canonicalizer.
+func (p SigningParams) Digest(hash crypto.Hash) []byte {
+	h := hash.New()
+	h.Write([]byte(p.String()))
+	return h.Sum(nil)
 }
 
 // URLSigner provides a type that can generate signed URLs for use with Google
@@ -95,29 +387,436 @@ func (p SigningParams) String() string {
 type URLSigner struct {
 	PrivateKey  *rsa.PrivateKey
 	ClientEmail string
+
+	// AccessID is the value used for the GoogleAccessId query parameter of
+	// signed URLs. If not supplied, then ClientEmail will be used instead.
+	AccessID string
+
+	// Signer is the signer used for generating signatures when PrivateKey is
+	// not supplied, such as for ECDSA keys.
+	Signer crypto.Signer
+
+	// Backend is the remote signing backend used for generating signatures
+	// when neither PrivateKey nor Signer is supplied.
+	Backend Backend
+
+	// Client is the HTTP client used for requests made by the URLSigner. If
+	// not supplied, then http.DefaultClient will be used instead.
+	Client *http.Client
+
+	// BaseURL is the base URL to use for building URLs, such as a private
+	// endpoint or proxy, which may include a port and a path prefix. If not
+	// supplied, then DefaultBaseURL will be used instead.
+	BaseURL *url.URL
+
+	// expiration is the default expiration.
+	expiration time.Duration
+
+	// bucket is the default bucket.
+	bucket string
+
+	// keyID is the private key id of loaded credentials.
+	keyID string
+
+	// minKeyBits is the minimum size of RSA private keys.
+	minKeyBits int
+
+	// rand is the random source.
+	rand io.Reader
+
+	// clock returns the current time.
+	clock func() time.Time
+
+	// onRotate is called when a refreshed private key is swapped in.
+	onRotate func(KeyInfo)
+
+	// style is the URL style.
+	style URLStyle
+
+	// scheme is the signing scheme.
+	scheme SigningScheme
+
+	// hash is the hash used for generating signature digests.
+	hash crypto.Hash
+
+	// policies are the restrictions on signing params.
+	policies []Policy
+
+	// normalizeName normalizes object names.
+	normalizeName func(string) string
+
+	// defaultHeaders are the headers added to all signing params.
+	defaultHeaders map[string]string
+
+	// uploadHeaders are the headers added to uploads.
+	uploadHeaders map[string]string
+
+	// canonicalizer builds V2 strings to sign.
+	canonicalizer Canonicalizer
+
+	// nameValidators are the upload object name validators.
+	nameValidators []NameValidator
+
+	// cdn is the signer for URLs with a start time.
+	cdn *CDNSigner
+
+	// deadlineExpiration toggles deriving expiration from context deadlines.
+	deadlineExpiration bool
+
+	// minExpiration is the minimum duration of a deadline derived expiration.
+	minExpiration time.Duration
+
+	// setup are funcs run by NewURLSigner after the options are applied.
+	setup []func(*URLSigner) error
+
+	// start are funcs run by NewURLSigner once the URLSigner has been
+	// successfully constructed, such as for starting background refreshes.
+	start []func()
 }
 
-// NewURLSigner creates a new URLSigner
+// NewURLSigner creates a new URLSigner, returning ErrMissingPrivateKey or
+// ErrMissingClientEmail when the options do not configure a usable signer.
+//
+// When the STORAGE_EMULATOR_HOST environment variable is set, then generated
+// URLs will use the emulator, as with WithEmulator.
+//
+// When the options do not provide a private key, signer, or backend, and
+// running on Google Compute Engine (or GKE), then the URLSigner will sign on
+// behalf of the instance's default service account, as with
+// WithMetadataServer, when the metadata server is available. The metadata
+// server is only probed when the GCE_METADATA_HOST environment variable is
+// set, or the system's DMI product name is Google's, so construction is not
+// delayed elsewhere. On Cloud Run and other hosts without DMI information,
+// use WithMetadataServer or WithDefaultCredentials.
 func NewURLSigner(opts ...Option) (*URLSigner, error) {
 	u := &URLSigner{}
+	// use emulator from environment
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+		if err := WithEmulator(host)(u); err != nil {
+			return nil, fmt.Errorf("invalid STORAGE_EMULATOR_HOST: %v", err)
+		}
+	}
 	// apply opts
 	for _, o := range opts {
 		if err := o(u); err != nil {
 			return nil, err
 		}
 	}
+	for _, f := range u.setup {
+		if err := f(u); err != nil {
+			return nil, err
+		}
+	}
+	// detect metadata server
+	if onGCE() {
+		if err := withMetadataFallback(context.Background())(u); err != nil {
+			return nil, err
+		}
+	}
+	if err := u.Validate(); err != nil {
+		return nil, err
+	}
+	for _, f := range u.start {
+		f()
+	}
+	u.start = nil
 	return u, nil
 }
 
-// SigningParams signs using the URLSigner.
-func (u *URLSigner) SigningParams(p *SigningParams) (string, error) {
+// Validate validates that the URLSigner has a private key, signer, or
+// backend, and a client email (or access id), that RSA private keys are not
+// weaker than the minimum key size (see WithMinRSAKeyBits), and that the
+// signature hash is usable for the signing scheme (see WithSignatureHash).
+func (u *URLSigner) Validate() error {
+	switch {
+	case u.PrivateKey != nil:
+		if err := u.checkKey(u.PrivateKey); err != nil {
+			return err
+		}
+	case u.Signer != nil:
+		if err := u.checkKey(u.Signer); err != nil {
+			return err
+		}
+	case u.Backend != nil:
+		if b, ok := u.Backend.(*keyBackend); ok {
+			if err := u.checkKey(b.current().Signer); err != nil {
+				return err
+			}
+		}
+	default:
+		return ErrMissingPrivateKey
+	}
+	if _, lazy := u.Backend.(*lazyBackend); u.ClientEmail == "" && u.AccessID == "" && !lazy {
+		return ErrMissingClientEmail
+	}
+	// google cloud storage v2 and v4 signatures are rsa-sha256
+	if hash := u.signatureHash(); hash != crypto.SHA256 && (u.canonicalizer == nil || u.scheme == SigningSchemeV4) {
+		return fmt.Errorf("signature hash %v requires a v2 canonicalizer (see WithCanonicalizer), google cloud storage signatures are rsa-sha256", hash)
+	}
+	return nil
+}
+
+// accessID returns the access id for the URLSigner.
+func (u *URLSigner) accessID() string {
+	switch {
+	case u.AccessID != "":
+		return u.AccessID
+	case u.ClientEmail != "":
+		return u.ClientEmail
+	}
+	switch b := u.Backend.(type) {
+	case *lazyBackend:
+		if l := b.loaded(); l != nil {
+			return l.accessID()
+		}
+	case *scopedBackend:
+		return b.u.accessID()
+	}
+	return ""
+}
+
+// resolveAccessID returns the access id, as with accessID, first loading
+// deferred credentials (see WithLazyCredentials) when the access id is not
+// otherwise known, for signing schemes that include the access id in the
+// string to sign.
+func (u *URLSigner) resolveAccessID() (string, error) {
+	if id := u.accessID(); id != "" {
+		return id, nil
+	}
+	switch b := u.Backend.(type) {
+	case *lazyBackend:
+		l, err := b.get()
+		if err != nil {
+			return "", err
+		}
+		return l.resolveAccessID()
+	case *scopedBackend:
+		return b.u.resolveAccessID()
+	}
+	return "", ErrMissingClientEmail
+}
+
+// now returns the current time, using the URLSigner's clock.
+func (u *URLSigner) now() time.Time {
+	if u.clock != nil {
+		return u.clock()
+	}
+	return time.Now()
+}
+
+// random returns the random source for the URLSigner.
+func (u *URLSigner) random() io.Reader {
+	if u.rand != nil {
+		return u.rand
+	}
+	return rand.Reader
+}
+
+// defaultExpiration returns the default expiration for the URLSigner.
+func (u *URLSigner) defaultExpiration() time.Duration {
+	if u.expiration != 0 {
+		return u.expiration
+	}
+	return DefaultExpiration
+}
+
+// client returns the HTTP client for the URLSigner.
+func (u *URLSigner) client() *http.Client {
+	if u.Client != nil {
+		return u.Client
+	}
+	return http.DefaultClient
+}
+
+// sign signs buf using the URLSigner's private key, signer, or backend.
+// Backends that are not local keys sign buf directly when the signature hash
+// is SHA-256, and otherwise must be a DigestSigner.
+func (u *URLSigner) sign(ctx context.Context, buf []byte) ([]byte, error) {
+	hash := u.signatureHash()
+	if u.PrivateKey == nil && u.Signer == nil {
+		switch b := u.Backend.(type) {
+		case nil:
+			return nil, ErrMissingPrivateKey
+		case *scopedBackend:
+			return b.u.sign(ctx, buf)
+		case localSigner:
+		default:
+			if hash == crypto.SHA256 {
+				sig, err := u.Backend.SignBytes(ctx, buf)
+				return signResult(fmt.Sprintf("%T", u.Backend), sig, err)
+			}
+		}
+	}
 	// hash
-	h := crypto.SHA256.New()
-	if _, err := h.Write([]byte(p.String())); err != nil {
+	h := hash.New()
+	if _, err := h.Write(buf); err != nil {
+		return nil, err
+	}
+	return u.signDigest(ctx, h.Sum(nil))
+}
+
+// signDigest signs the digest using the URLSigner's private key, signer, or
+// backend.
+func (u *URLSigner) signDigest(ctx context.Context, digest []byte) ([]byte, error) {
+	hash := u.signatureHash()
+	if len(digest) != hash.Size() {
+		return nil, fmt.Errorf("invalid digest length %d for %v", len(digest), hash)
+	}
+	switch {
+	case u.PrivateKey != nil:
+		sig, err := rsa.SignPKCS1v15(u.random(), u.PrivateKey, hash, digest)
+		return signResult("private key", sig, err)
+	case u.Signer != nil:
+		sig, err := u.Signer.Sign(u.random(), digest, hash)
+		return signResult(fmt.Sprintf("%T", u.Signer), sig, err)
+	case u.Backend != nil:
+		switch b := u.Backend.(type) {
+		case *scopedBackend:
+			return b.u.signDigest(ctx, digest)
+		case localSigner:
+			sig, err := b.signDigestRand(u.random(), hash, digest)
+			return signResult(fmt.Sprintf("%T", b), sig, err)
+		case DigestSigner:
+			sig, err := b.SignDigest(ctx, hash, digest)
+			return signResult(fmt.Sprintf("%T", b), sig, err)
+		}
+		return nil, errors.New("backend does not support signing digests")
+	}
+	return nil, ErrMissingPrivateKey
+}
+
+// signResult returns the signature, or a *SignError for the backend when err
+// is not nil.
+func signResult(backend string, sig []byte, err error) ([]byte, error) {
+	if err != nil {
+		return nil, &SignError{Backend: backend, Cause: err}
+	}
+	return sig, nil
+}
+
+// signatureHash returns the hash used for generating signature digests.
+func (u *URLSigner) signatureHash() crypto.Hash {
+	if u.hash != 0 {
+		return u.hash
+	}
+	return DefaultSignatureHash
+}
+
+// check sets the URLSigner's default bucket (when the signing params have no
+// bucket), adds the URLSigner's default and upload headers, normalizes the
+// signing params' object name, and checks the signing params are valid for
+// the URLSigner's signing scheme (see SigningParams.Validate), and are
+// allowed by the URLSigner's policies and name validators. When signing, the
+// expiration must be in the future.
+func (u *URLSigner) check(p *SigningParams, signing bool) error {
+	if p.Bucket == "" {
+		p.Bucket = u.bucket
+	}
+	*p = u.withHeaders(*p)
+	if u.normalizeName != nil {
+		p.Object = u.normalizeName(p.Object)
+	}
+	if err := u.validate(p, signing); err != nil {
+		return err
+	}
+	for _, policy := range u.policies {
+		if err := policy.check(p); err != nil {
+			return err
+		}
+	}
+	return u.checkName(p)
+}
+
+// SignDigest signs a precomputed digest of a string to sign, returning the
+// base64 encoded signature. The digest must have been generated with the
+// URLSigner's signature hash (by default, SHA-256, see WithSignatureHash).
+//
+// As the signed request cannot be checked, SignDigest returns an error when
+// the URLSigner has policies (see WithPolicy and Scoped) or name validators.
+// Use SigningParamsDigest instead.
+func (u *URLSigner) SignDigest(digest []byte) (string, error) {
+	return u.SignDigestContext(context.Background(), digest)
+}
+
+// SignDigestContext signs a precomputed digest of a string to sign, as with
+// SignDigest, using the context for any remote signing requests.
+func (u *URLSigner) SignDigestContext(ctx context.Context, digest []byte) (string, error) {
+	if len(u.policies) != 0 || len(u.nameValidators) != 0 {
+		return "", errors.New("signing unchecked digests is not allowed by the signer's policy")
+	}
+	return u.signDigestString(ctx, digest)
+}
+
+// SigningParamsDigest signs using the URLSigner, as with SigningParams, but
+// uses the precomputed digest of the string to sign for the signing params
+// instead of hashing the string.
+//
+// The signing params are checked as with SigningParams, and the digest must
+// match the digest of the string to sign for the checked signing params (ie,
+// with the URLSigner's default headers, name normalization, and
+// canonicalizer applied).
+func (u *URLSigner) SigningParamsDigest(p *SigningParams, digest []byte) (string, error) {
+	return u.SigningParamsDigestContext(context.Background(), p, digest)
+}
+
+// SigningParamsDigestContext signs using the URLSigner, as with
+// SigningParamsDigest, using the context for any remote signing requests.
+func (u *URLSigner) SigningParamsDigestContext(ctx context.Context, p *SigningParams, digest []byte) (string, error) {
+	q := *p
+	if err := u.check(&q, true); err != nil {
+		return "", err
+	}
+	str, err := u.stringToSign(&q)
+	if err != nil {
+		return "", err
+	}
+	h := u.signatureHash().New()
+	if _, err := h.Write([]byte(str)); err != nil {
+		return "", err
+	}
+	if !hmac.Equal(h.Sum(nil), digest) {
+		return "", errors.New("digest does not match signing params")
+	}
+	return u.signDigestString(ctx, digest)
+}
+
+// signDigestString signs the digest, returning the base64 encoded signature.
+func (u *URLSigner) signDigestString(ctx context.Context, digest []byte) (string, error) {
+	sig, err := u.signDigest(ctx, digest)
+	if err != nil {
+		return "", err
+	}
+	return b64.StdEncoding.EncodeToString(sig), nil
+}
+
+// SigningParams signs using the URLSigner. The signing params are not
+// modified. When the signing params have a TTL, the signature expires the TTL
+// from now.
+func (u *URLSigner) SigningParams(p *SigningParams) (string, error) {
+	return u.SigningParamsContext(context.Background(), p)
+}
+
+// SigningParamsContext signs using the URLSigner, as with SigningParams, using
+// the context for any remote signing requests.
+func (u *URLSigner) SigningParamsContext(ctx context.Context, p *SigningParams) (string, error) {
+	q := *p
+	if q.TTL != 0 {
+		q.Expiration = u.now().Add(q.TTL)
+	}
+	return u.signingParams(ctx, &q)
+}
+
+// signingParams signs the signing params using the URLSigner.
+func (u *URLSigner) signingParams(ctx context.Context, p *SigningParams) (string, error) {
+	if err := u.check(p, true); err != nil {
 		return "", err
 	}
 	// sign
-	sig, err := rsa.SignPKCS1v15(rand.Reader, u.PrivateKey, crypto.SHA256, h.Sum(nil))
+	str, err := u.stringToSign(p)
+	if err != nil {
+		return "", err
+	}
+	sig, err := u.sign(ctx, []byte(str))
 	if err != nil {
 		return "", err
 	}
@@ -127,62 +826,274 @@ func (u *URLSigner) SigningParams(p *SigningParams) (string, error) {
 
 // Sign creates the signature for the provided method, hash, contentType, bucket,
 // and path accordingly.
+//
+// Deprecated: as the signature has no expiration, Sign returns an error
+// wrapping ErrExpired. Use SigningParams with an Expiration or TTL.
 func (u *URLSigner) Sign(method, hash, contentType, bucket, path string, headers map[string]string) (string, error) {
-	return u.SigningParams(&SigningParams{
+	return u.SignContext(context.Background(), method, hash, contentType, bucket, path, headers)
+}
+
+// SignContext creates the signature for the provided method, hash,
+// contentType, bucket, and path, as with Sign, using the context for any
+// remote signing requests.
+//
+// Deprecated: use SigningParamsContext with an Expiration or TTL.
+func (u *URLSigner) SignContext(ctx context.Context, method, hash, contentType, bucket, path string, headers map[string]string) (string, error) {
+	return u.SigningParamsContext(ctx, &SigningParams{
 		Method:      method,
 		Hash:        hash,
 		ContentType: contentType,
-		Headers:     headers,
+		Headers:     headerValues(headers),
 		Bucket:      bucket,
 		Object:      path,
 	})
 }
 
-// Make makes a URL for the specified signing params.
+// Make makes a URL for the specified signing params. The signing params are
+// not modified.
 func (u *URLSigner) Make(p *SigningParams, d time.Duration) (string, error) {
-	// set default expiration if duration supplied
-	if d != 0 {
-		p.Expiration = time.Now().Add(d)
+	return u.MakeContext(context.Background(), p, d)
+}
+
+// MakeContext makes a URL for the specified signing params, using the context
+// for any remote signing requests. The signing params are not modified; use
+// MakeSignedContext to retrieve the computed expiration.
+//
+// When the URLSigner was created with WithDeadlineExpiration and the context
+// has a deadline earlier than the expiration, then the expiration will be
+// set to the context's deadline.
+func (u *URLSigner) MakeContext(ctx context.Context, p *SigningParams, d time.Duration) (string, error) {
+	urlstr, _, err := u.make(ctx, p, d)
+	return urlstr, err
+}
+
+// make makes a URL for a copy of the specified signing params, returning the
+// URL and the computed expiration.
+func (u *URLSigner) make(ctx context.Context, params *SigningParams, d time.Duration) (string, time.Time, error) {
+	p := *params
+	if p.Bucket == "" {
+		p.Bucket = u.bucket
+	}
+	now := u.now()
+	// set expiration if duration supplied, or from the ttl
+	switch {
+	case d != 0:
+		p.Expiration = now.Add(d)
+	case p.TTL != 0:
+		p.Expiration = now.Add(p.TTL)
+	}
+	// derive expiration from deadline
+	if deadline, ok := ctx.Deadline(); ok && u.deadlineExpiration {
+		if min := now.Add(u.minExpiration); deadline.Before(min) {
+			deadline = min
+		}
+		if p.Expiration.IsZero() || deadline.Before(p.Expiration) {
+			p.Expiration = deadline
+		}
+	}
+	// make using the cdn for start time, or the signing scheme
+	var urlstr string
+	var err error
+	switch {
+	case !p.NotBefore.IsZero():
+		urlstr, err = u.makeCDN(&p)
+	case u.scheme == SigningSchemeV4:
+		urlstr, err = u.makeV4(ctx, &p, now)
+	default:
+		urlstr, err = u.makeV2(ctx, &p)
+	}
+	if err != nil {
+		return "", time.Time{}, err
 	}
+	return urlstr, p.Expiration, nil
+}
+
+// makeV2 makes a V2 signed URL for the signing params.
+func (u *URLSigner) makeV2(ctx context.Context, p *SigningParams) (string, error) {
 	// create sig
-	sig, err := u.SigningParams(p)
+	sig, err := u.signingParams(ctx, p)
 	if err != nil {
 		return "", err
 	}
 	// create query
 	v := url.Values{}
-	v.Set("GoogleAccessId", u.ClientEmail)
+	v.Set("GoogleAccessId", u.accessID())
 	v.Set("Expires", strconv.FormatInt(p.Expiration.Unix(), 10))
 	v.Set("Signature", sig)
-	// base
-	baseURL := p.BaseURL
-	if baseURL == "" {
-		baseURL = DefaultBaseURL
+	p.Response.query(v)
+	query := canonicalQuery(v)
+	if s := strings.TrimPrefix(p.Subresource, "?"); s != "" {
+		query = s + "&" + query
+	}
+	if len(p.ExtraQuery) != 0 {
+		query += "&" + canonicalQuery(p.ExtraQuery)
+	}
+	return u.objectURL(p) + "?" + query, nil
+}
+
+// URLStyle is a URL style for generated URLs.
+type URLStyle int
+
+// URL styles.
+const (
+	// PathStyle is the path style URL, https://storage.googleapis.com/<bucket>/<object>.
+	PathStyle URLStyle = iota
+
+	// VirtualHostedStyle is the virtual hosted style URL,
+	// https://<bucket>.storage.googleapis.com/<object>.
+	VirtualHostedStyle
+)
+
+// objectURL returns the URL (without query) for the signing params, using
+// the signing params' bucket bound hostname or the URLSigner's URL style.
+func (u *URLSigner) objectURL(p *SigningParams) string {
+	if h := p.BucketBoundHostname; h != "" {
+		if !strings.Contains(h, "://") {
+			h = "https://" + h
+		}
+		return strings.TrimSuffix(h, "/") + "/" + escapePath(strings.TrimPrefix(p.Object, "/"))
+	}
+	base := u.baseURL(p)
+	prefix := strings.TrimSuffix(base.EscapedPath(), "/")
+	if u.style == VirtualHostedStyle {
+		return base.Scheme + "://" + strings.Trim(p.Bucket, "/") + "." + base.Host + prefix + "/" + escapePath(strings.TrimPrefix(p.Object, "/"))
+	}
+	return base.Scheme + "://" + base.Host + prefix + p.EscapedObjectPath()
+}
+
+// baseURL returns the base URL for the signing params.
+func (u *URLSigner) baseURL(p *SigningParams) *url.URL {
+	switch {
+	case p.BaseURL != nil:
+		return p.BaseURL
+	case u.BaseURL != nil:
+		return u.BaseURL
 	}
-	return baseURL + p.ObjectPath() + "?" + v.Encode(), nil
+	return &url.URL{Scheme: "https", Host: strings.TrimPrefix(DefaultBaseURL, "https://")}
 }
 
 // MakeURL creates a signed URL for the method.
 func (u *URLSigner) MakeURL(method, bucket, path string, d time.Duration, headers map[string]string) (string, error) {
-	return u.Make(&SigningParams{
+	return u.MakeURLContext(context.Background(), method, bucket, path, d, headers)
+}
+
+// MakeURLContext creates a signed URL for the method, using the context for
+// any remote signing requests.
+func (u *URLSigner) MakeURLContext(ctx context.Context, method, bucket, path string, d time.Duration, headers map[string]string) (string, error) {
+	return u.MakeContext(ctx, &SigningParams{
 		Method:  method,
-		Headers: headers,
+		Headers: headerValues(headers),
 		Bucket:  bucket,
 		Object:  path,
 	}, d)
 }
 
+// headerValues converts single valued headers to multi-valued headers.
+func headerValues(headers map[string]string) http.Header {
+	if headers == nil {
+		return nil
+	}
+	h := make(http.Header, len(headers))
+	for k, v := range headers {
+		h[k] = []string{v}
+	}
+	return h
+}
+
+// BucketURL creates a signed URL for a bucket-level request, such as listing
+// a bucket's objects.
+func (u *URLSigner) BucketURL(method, bucket string, d time.Duration, headers map[string]string) (string, error) {
+	return u.MakeURL(method, bucket, "", d, headers)
+}
+
 // DownloadPath generates a signed path for downloading an object.
 func (u *URLSigner) DownloadPath(bucket, path string) (string, error) {
-	return u.MakeURL("GET", bucket, path, DefaultExpiration, nil)
+	return u.MakeURL("GET", bucket, path, u.defaultExpiration(), nil)
+}
+
+// DownloadPathAs generates a signed path for downloading an object as an
+// attachment with the filename, and with the content type (when not empty),
+// using the response-content-disposition and response-content-type response
+// header overrides. Non-ASCII filenames are encoded as described in
+// ContentDisposition.
+func (u *URLSigner) DownloadPathAs(bucket, path, filename, contentType string) (string, error) {
+	return u.Make(&SigningParams{
+		Method: "GET",
+		Bucket: bucket,
+		Object: path,
+		Response: ResponseHeaders{
+			ContentType:        contentType,
+			ContentDisposition: ContentDisposition("attachment", filename),
+		},
+	}, u.defaultExpiration())
+}
+
+// HeadPath generates a signed path for retrieving an object's metadata, such
+// as for checking an object exists.
+func (u *URLSigner) HeadPath(bucket, path string) (string, error) {
+	return u.MakeURL("HEAD", bucket, path, u.defaultExpiration(), nil)
+}
+
+// OptionsPath generates a signed path for CORS preflight requests for an
+// object.
+func (u *URLSigner) OptionsPath(bucket, path string) (string, error) {
+	return u.MakeURL("OPTIONS", bucket, path, u.defaultExpiration(), nil)
 }
 
 // UploadPath generates a signed path for uploading an object.
 func (u *URLSigner) UploadPath(bucket, path string) (string, error) {
-	return u.MakeURL("PUT", bucket, path, DefaultExpiration, nil)
+	return u.MakeURL("PUT", bucket, path, u.defaultExpiration(), nil)
 }
 
 // DeletePath generates a signed path for deleting an object.
 func (u *URLSigner) DeletePath(bucket, path string) (string, error) {
-	return u.MakeURL("DELETE", bucket, path, DefaultExpiration, nil)
+	return u.MakeURL("DELETE", bucket, path, u.defaultExpiration(), nil)
+}
+
+// DeleteGenerationPath generates a signed path for deleting the specified
+// generation of an object. The x-goog-if-generation-match header is included
+// in the signature, and must be sent with the request, so that the delete
+// fails if the object was replaced by a different generation.
+func (u *URLSigner) DeleteGenerationPath(bucket, path string, generation int64) (string, error) {
+	return u.MakeURL("DELETE", bucket, path, u.defaultExpiration(), generationMatch(generation))
+}
+
+// DownloadGenerationPath generates a signed path for downloading the
+// specified generation of an object, using the generation query parameter.
+//
+// As V2 signatures do not include the generation query parameter,
+// DownloadGenerationPath always generates V4 signed URLs (as with ListURL),
+// which sign all query parameters, so that the URL cannot be used to
+// download a different generation.
+func (u *URLSigner) DownloadGenerationPath(bucket, path string, generation int64) (string, error) {
+	return u.generationPath("GET", bucket, path, generation)
+}
+
+// HeadGenerationPath generates a signed path for retrieving the metadata of
+// the specified generation of an object, as with DownloadGenerationPath.
+func (u *URLSigner) HeadGenerationPath(bucket, path string, generation int64) (string, error) {
+	return u.generationPath("HEAD", bucket, path, generation)
+}
+
+// generationPath generates a V4 signed path for the method and the specified
+// generation of an object.
+func (u *URLSigner) generationPath(method, bucket, path string, generation int64) (string, error) {
+	if generation <= 0 {
+		return "", fmt.Errorf("invalid generation %d", generation)
+	}
+	s := *u
+	s.scheme = SigningSchemeV4
+	return s.Make(&SigningParams{
+		Method:      method,
+		Bucket:      bucket,
+		Object:      path,
+		Subresource: "generation=" + strconv.FormatInt(generation, 10),
+	}, u.defaultExpiration())
+}
+
+// generationMatch returns the headers for a generation conditioned request.
+func generationMatch(generation int64) map[string]string {
+	return map[string]string{
+		"x-goog-if-generation-match": strconv.FormatInt(generation, 10),
+	}
 }
@@ -0,0 +1,256 @@
+package gstorage
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSigningParamsDigest(t *testing.T) {
+	u := &URLSigner{PrivateKey: loadTestKey(t), ClientEmail: "test@example.com"}
+	if err := WithDefaultHeaders(map[string]string{"x-goog-meta-source": "test"})(u); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	p := &SigningParams{
+		Method:     "GET",
+		Bucket:     "bucket",
+		Object:     "public/file.txt",
+		Expiration: time.Now().Add(time.Hour),
+	}
+	exp, err := u.SigningParams(p)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	// digest of the checked string to sign
+	q := *p
+	if err := u.check(&q, true); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	digest := q.Digest(crypto.SHA256)
+	sig, err := u.SigningParamsDigest(p, digest)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if sig != exp {
+		t.Errorf("expected signature %q, got: %q", exp, sig)
+	}
+	if sig, err = u.SignDigest(digest); err != nil || sig != exp {
+		t.Errorf("expected signature %q, got: %q, %v", exp, sig, err)
+	}
+	// digest of other params
+	r := q
+	r.Object = "private/file.txt"
+	if _, err := u.SigningParamsDigest(p, r.Digest(crypto.SHA256)); err == nil {
+		t.Error("expected error for mismatched digest")
+	}
+	// scoped signers check the params and refuse unchecked digests
+	s := u.Scoped(Policy{Prefixes: []string{"public"}})
+	if sig, err = s.SigningParamsDigest(p, digest); err != nil || sig != exp {
+		t.Errorf("expected signature %q, got: %q, %v", exp, sig, err)
+	}
+	if _, err := s.SigningParamsDigest(&SigningParams{Method: "GET", Bucket: "bucket", Object: "private/file.txt", Expiration: p.Expiration}, r.Digest(crypto.SHA256)); err == nil {
+		t.Error("expected error for params not allowed by policy")
+	}
+	if _, err := s.SignDigest(r.Digest(crypto.SHA256)); err == nil {
+		t.Error("expected error for unchecked digest on scoped signer")
+	}
+}
+
+func TestGenerationPath(t *testing.T) {
+	key := loadTestKey(t)
+	u := &URLSigner{PrivateKey: key, ClientEmail: "test@example.com"}
+	tests := []struct {
+		method string
+		f      func(string, string, int64) (string, error)
+	}{
+		{"GET", u.DownloadGenerationPath},
+		{"HEAD", u.HeadGenerationPath},
+	}
+	for i, test := range tests {
+		urlstr, err := test.f("bucket", "file.txt", 1234)
+		if err != nil {
+			t.Fatalf("test %d expected no error, got: %v", i, err)
+		}
+		v, err := url.Parse(urlstr)
+		if err != nil {
+			t.Fatalf("test %d expected no error, got: %v", i, err)
+		}
+		// v2 signatures do not include the generation, so v4 is used
+		q := v.Query()
+		if s := q.Get("X-Goog-Algorithm"); s != "GOOG4-RSA-SHA256" {
+			t.Fatalf("test %d expected v4 signed url, got: %s", i, urlstr)
+		}
+		if s := q.Get("generation"); s != "1234" {
+			t.Errorf("test %d expected generation 1234, got: %q", i, s)
+		}
+		// rebuild the v4 canonical request, and check the signature
+		sig, err := hex.DecodeString(q.Get("X-Goog-Signature"))
+		if err != nil {
+			t.Fatalf("test %d expected no error, got: %v", i, err)
+		}
+		q.Del("X-Goog-Signature")
+		date := q.Get("X-Goog-Date")
+		verify := func(query string) error {
+			req := sha256.Sum256([]byte(test.method + "\n" +
+				"/bucket/file.txt\n" +
+				query + "\n" +
+				"host:storage.googleapis.com\n\n" +
+				"host\n" +
+				"UNSIGNED-PAYLOAD"))
+			digest := sha256.Sum256([]byte("GOOG4-RSA-SHA256\n" + date + "\n" + date[:8] + "/auto/storage/goog4_request\n" + hex.EncodeToString(req[:])))
+			return rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig)
+		}
+		if err := verify(q.Encode()); err != nil {
+			t.Errorf("test %d expected signature to verify, got: %v", i, err)
+		}
+		// the generation is signed
+		q.Set("generation", "1235")
+		if err := verify(q.Encode()); err == nil {
+			t.Errorf("test %d expected signature to not verify for a different generation", i)
+		}
+	}
+	if _, err := u.DownloadGenerationPath("bucket", "file.txt", 0); err == nil {
+		t.Error("expected error for invalid generation")
+	}
+	// copy
+	u.scheme = SigningSchemeV4
+	s, err := u.CopyURL("bucket", "src.txt", "bucket", "dst.txt", 1234, time.Hour)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if g := s.Headers["X-Goog-Copy-Source-Generation"]; g != "1234" {
+		t.Errorf("expected source generation header 1234, got: %q", g)
+	}
+	v, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if h := v.Query().Get("X-Goog-SignedHeaders"); !strings.Contains(h, "x-goog-copy-source-generation") {
+		t.Errorf("expected x-goog-copy-source-generation to be signed, got: %q", h)
+	}
+}
+
+func TestFolderObjects(t *testing.T) {
+	tests := []struct {
+		method string
+		object string
+		scheme SigningScheme
+		style  URLStyle
+		exp    string
+	}{
+		{"PUT", "dir/", SigningSchemeV2, PathStyle, "/bucket/dir/"},
+		{"DELETE", "/dir/", SigningSchemeV2, PathStyle, "/bucket/dir/"},
+		{"PUT", "a/b/", SigningSchemeV2, VirtualHostedStyle, "/a/b/"},
+		{"PUT", "dir/", SigningSchemeV4, PathStyle, "/bucket/dir/"},
+		{"DELETE", "/a/b/", SigningSchemeV4, PathStyle, "/bucket/a/b/"},
+		{"DELETE", "dir/", SigningSchemeV4, VirtualHostedStyle, "/dir/"},
+	}
+	for i, test := range tests {
+		u := &URLSigner{PrivateKey: loadTestKey(t), ClientEmail: "test@example.com", scheme: test.scheme, style: test.style}
+		urlstr, err := u.MakeURL(test.method, "bucket", test.object, time.Hour, nil)
+		if err != nil {
+			t.Fatalf("test %d expected no error, got: %v", i, err)
+		}
+		v, err := url.Parse(urlstr)
+		if err != nil {
+			t.Fatalf("test %d expected no error, got: %v", i, err)
+		}
+		if v.Path != test.exp {
+			t.Errorf("test %d expected path %q, got: %q", i, test.exp, v.Path)
+		}
+		if test.scheme != SigningSchemeV2 {
+			continue
+		}
+		// signature is for the folder object, not the object without the
+		// trailing slash
+		q := v.Query()
+		expires, err := strconv.ParseInt(q.Get("Expires"), 10, 64)
+		if err != nil {
+			t.Fatalf("test %d expected no error, got: %v", i, err)
+		}
+		p := &SigningParams{Method: test.method, Bucket: "bucket", Object: test.object, Expiration: time.Unix(expires, 0)}
+		if err := u.Verify(p, q.Get("Signature")); err != nil {
+			t.Errorf("test %d expected no error, got: %v", i, err)
+		}
+		p.Object = strings.TrimSuffix(test.object, "/")
+		if err := u.Verify(p, q.Get("Signature")); err != ErrInvalidSignature {
+			t.Errorf("test %d expected ErrInvalidSignature, got: %v", i, err)
+		}
+	}
+}
+
+func TestSignatureHash(t *testing.T) {
+	key, err := ioutil.ReadFile("testdata/key.pem")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	tests := []struct {
+		opts []Option
+		err  bool
+	}{
+		{nil, false},
+		{[]Option{WithSignatureHash(crypto.SHA256), WithSigningScheme(SigningSchemeV4)}, false},
+		{[]Option{WithSignatureHash(crypto.SHA512)}, true},
+		{[]Option{WithLegacySHA1()}, true},
+		{[]Option{WithSignatureHash(crypto.SHA512), WithCanonicalizer(DefaultCanonicalizer), WithSigningScheme(SigningSchemeV4)}, true},
+		{[]Option{WithSignatureHash(crypto.SHA1)}, true},
+		{[]Option{WithSignatureHash(crypto.SHA512), WithCanonicalizer(DefaultCanonicalizer)}, false},
+		{[]Option{WithLegacySHA1(), WithCanonicalizer(DefaultCanonicalizer)}, false},
+	}
+	for i, test := range tests {
+		opts := append([]Option{WithPrivateKey(key), WithClientEmail("test@example.com")}, test.opts...)
+		_, err := NewURLSigner(opts...)
+		switch {
+		case test.err && err == nil:
+			t.Errorf("test %d expected error", i)
+		case !test.err && err != nil:
+			t.Errorf("test %d expected no error, got: %v", i, err)
+		}
+	}
+	// the hash is passed to local key backends
+	ring, err := NewKeyRing(Key{ID: "id", Signer: loadTestKey(t), NotBefore: time.Now().Add(-time.Hour)})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	p := &SigningParams{Method: "GET", Bucket: "bucket", Object: "file.txt", Expiration: time.Now().Add(time.Hour)}
+	for i, b := range []Backend{newKeyBackend(loadTestKey(t), "id"), ring} {
+		u := &URLSigner{Backend: b, ClientEmail: "test@example.com", hash: crypto.SHA512, canonicalizer: DefaultCanonicalizer}
+		sig, err := u.SigningParams(p)
+		if err != nil {
+			t.Fatalf("test %d expected no error, got: %v", i, err)
+		}
+		buf, err := base64.StdEncoding.DecodeString(sig)
+		if err != nil {
+			t.Fatalf("test %d expected no error, got: %v", i, err)
+		}
+		digest := sha512.Sum512([]byte(p.String()))
+		if err := rsa.VerifyPKCS1v15(&loadTestKey(t).PublicKey, crypto.SHA512, digest[:], buf); err != nil {
+			t.Errorf("test %d expected rsa-sha512 signature, got: %v", i, err)
+		}
+		if err := u.Verify(p, sig); err != nil {
+			t.Errorf("test %d expected no error, got: %v", i, err)
+		}
+	}
+	// backends that are not digest signers only sign rsa-sha256
+	var called bool
+	u := &URLSigner{Backend: signBytesFunc(func(buf []byte) ([]byte, error) {
+		called = true
+		return []byte("sig"), nil
+	}), ClientEmail: "test@example.com"}
+	if _, err := u.SigningParams(p); err != nil || !called {
+		t.Errorf("expected backend to sign, got: %v", err)
+	}
+	u.hash, u.canonicalizer, called = crypto.SHA512, DefaultCanonicalizer, false
+	if _, err := u.SigningParams(p); err == nil || called {
+		t.Error("expected error for rsa-sha512 with a backend that is not a digest signer")
+	}
+}
@@ -0,0 +1,208 @@
+// Package hardening provides property checks for validating signing
+// backends, signers, and the gstorage package's canonicalization against
+// randomly generated inputs, for use by downstream users prior to deploying
+// custom crypto.Signer or gstorage.Backend implementations.
+//
+// Each check returns an error describing the first failing input.
+package hardening
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	crand "crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	b64 "encoding/base64"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kenshaw/gstorage"
+)
+
+// DefaultIterations is the default number of random inputs checked.
+const DefaultIterations = 100
+
+// Checker runs property checks with random inputs.
+type Checker struct {
+	// Iterations is the number of random inputs checked. If not supplied,
+	// then DefaultIterations will be used instead.
+	Iterations int
+
+	// Seed is the seed for generating random inputs. If 0, then a time based
+	// seed will be used instead.
+	Seed int64
+}
+
+// iterations returns the number of iterations.
+func (c Checker) iterations() int {
+	if c.Iterations > 0 {
+		return c.Iterations
+	}
+	return DefaultIterations
+}
+
+// rand returns the random source for generating inputs.
+func (c Checker) rand() *rand.Rand {
+	seed := c.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return rand.New(rand.NewSource(seed))
+}
+
+// Signer checks that signatures generated by the signer for random SHA-256
+// digests verify using the signer's public key. The signer is always passed
+// crypto/rand.Reader as its entropy source, as the seeded input generator is
+// not suitable for use with real keys.
+func (c Checker) Signer(signer crypto.Signer) error {
+	r := c.rand()
+	for i := 0; i < c.iterations(); i++ {
+		buf := randBytes(r, 1+r.Intn(512))
+		digest := sha256.Sum256(buf)
+		sig, err := signer.Sign(crand.Reader, digest[:], crypto.SHA256)
+		if err != nil {
+			return fmt.Errorf("sign %x: %v", buf, err)
+		}
+		if err := verify(signer.Public(), digest[:], sig); err != nil {
+			return fmt.Errorf("verify %x: %v", buf, err)
+		}
+	}
+	return nil
+}
+
+// Backend checks that signatures generated by the backend for random inputs
+// are RSA-SHA256 signatures that verify using the public key.
+func (c Checker) Backend(ctx context.Context, backend gstorage.Backend, pub crypto.PublicKey) error {
+	r := c.rand()
+	for i := 0; i < c.iterations(); i++ {
+		buf := randBytes(r, 1+r.Intn(512))
+		sig, err := backend.SignBytes(ctx, buf)
+		if err != nil {
+			return fmt.Errorf("sign %x: %v", buf, err)
+		}
+		digest := sha256.Sum256(buf)
+		if err := verify(pub, digest[:], sig); err != nil {
+			return fmt.Errorf("verify %x: %v", buf, err)
+		}
+	}
+	return nil
+}
+
+// URLSigner checks that the signatures generated by the URLSigner for random
+// signing params verify with the URLSigner's Verify.
+func (c Checker) URLSigner(u *gstorage.URLSigner) error {
+	r := c.rand()
+	for i := 0; i < c.iterations(); i++ {
+		p := randParams(r)
+		sig, err := u.SigningParams(p)
+		if err != nil {
+			return fmt.Errorf("sign %q: %v", p.String(), err)
+		}
+		if _, err := b64.StdEncoding.DecodeString(sig); err != nil {
+			return fmt.Errorf("sign %q: invalid signature encoding: %v", p.String(), err)
+		}
+		if err := u.Verify(p, sig); err != nil {
+			return fmt.Errorf("verify %q: %v", p.String(), err)
+		}
+	}
+	return nil
+}
+
+// Canonicalization checks that canonicalizing random headers is idempotent,
+// and that gs:// URLs of random bucket and object names decode to the same
+// bucket and object names.
+func (c Checker) Canonicalization() error {
+	r := c.rand()
+	for i := 0; i < c.iterations(); i++ {
+		p := randParams(r)
+		s := p.HeaderString()
+		q := gstorage.SigningParams{Headers: parseHeaderString(s)}
+		if z := q.HeaderString(); z != s {
+			return fmt.Errorf("canonical headers not idempotent for %q: %q != %q", p.Headers, z, s)
+		}
+		bucket, object, err := gstorage.ParseGSURL("gs://" + p.Bucket + "/" + p.Object)
+		if err != nil {
+			return fmt.Errorf("parse gs://%s/%s: %v", p.Bucket, p.Object, err)
+		}
+		if bucket != p.Bucket || object != p.Object {
+			return fmt.Errorf("parse gs://%s/%s: got bucket %q, object %q", p.Bucket, p.Object, bucket, object)
+		}
+	}
+	return nil
+}
+
+// verify verifies the signature of the digest using the public key.
+func verify(pub crypto.PublicKey, digest, sig []byte) error {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, digest, sig)
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, digest, sig) {
+			return gstorage.ErrInvalidSignature
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported public key type %T", pub)
+}
+
+// parseHeaderString parses a canonical header string.
+func parseHeaderString(s string) http.Header {
+	headers := make(http.Header)
+	for _, line := range strings.Split(strings.TrimSuffix(s, "\n"), "\n") {
+		if i := strings.IndexByte(line, ':'); i != -1 {
+			headers[line[:i]] = append(headers[line[:i]], line[i+1:])
+		}
+	}
+	return headers
+}
+
+// randParams generates random signing params.
+func randParams(r *rand.Rand) *gstorage.SigningParams {
+	methods := []string{"GET", "HEAD", "PUT", "POST", "DELETE"}
+	p := &gstorage.SigningParams{
+		Method:     methods[r.Intn(len(methods))],
+		Expiration: time.Now().Add(time.Duration(1+r.Intn(3600)) * time.Second),
+		Bucket:     randBucket(r),
+		Object:     randString(r, "abcdefghijklmnopqrstuvwxyz", 1) + randString(r, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./ ~äöü世界", r.Intn(64)),
+		Headers:    make(http.Header),
+	}
+	if p.Method == "PUT" || p.Method == "POST" {
+		p.ContentType = "application/octet-stream"
+		p.Hash = b64.StdEncoding.EncodeToString(randBytes(r, 16))
+	}
+	for i := r.Intn(5); i > 0; i-- {
+		name := randString(r, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ-", 1+r.Intn(12))
+		for j := 1 + r.Intn(2); j > 0; j-- {
+			p.Headers["x-goog-meta-"+name] = append(p.Headers["x-goog-meta-"+name], " "+randString(r, "abcdefghijklmnopqrstuvwxyz0123456789 ,;=", r.Intn(24))+" ")
+		}
+	}
+	return p
+}
+
+// randBucket returns a random, valid bucket name. The letter g is not used,
+// so that names never start with goog or contain google.
+func randBucket(r *rand.Rand) string {
+	const alnum = "abcdefhijklmnopqrstuvwxyz0123456789"
+	return randString(r, alnum, 1) + randString(r, alnum+"-", 1+r.Intn(20)) + randString(r, alnum, 1)
+}
+
+// randString generates a random string of n characters from chars.
+func randString(r *rand.Rand, chars string, n int) string {
+	c := []rune(chars)
+	s := make([]rune, n)
+	for i := range s {
+		s[i] = c[r.Intn(len(c))]
+	}
+	return string(s)
+}
+
+// randBytes generates n random bytes.
+func randBytes(r *rand.Rand, n int) []byte {
+	buf := make([]byte, n)
+	_, _ = r.Read(buf)
+	return buf
+}
@@ -0,0 +1,147 @@
+package hardening
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/kenshaw/gstorage"
+)
+
+func TestSigner(t *testing.T) {
+	key := loadTestKey(t)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	ec, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	tests := []struct {
+		signer crypto.Signer
+		ok     bool
+	}{
+		{key, true},
+		{ec, true},
+		{brokenSigner{key, func(sig []byte) []byte { sig[len(sig)-1] ^= 1; return sig }}, false},
+		{brokenSigner{key, func(sig []byte) []byte { return sig[1:] }}, false},
+		{wrongKeySigner{key, other}, false},
+		{brokenSigner{key, nil}, false},
+	}
+	for i, test := range tests {
+		err := Checker{Iterations: 10, Seed: 1}.Signer(test.signer)
+		switch {
+		case test.ok && err != nil:
+			t.Errorf("test %d expected no error, got: %v", i, err)
+		case !test.ok && err == nil:
+			t.Errorf("test %d expected error", i)
+		}
+	}
+}
+
+func TestBackend(t *testing.T) {
+	key := loadTestKey(t)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	ring, err := gstorage.NewKeyRing(gstorage.Key{ID: "a", Signer: key})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	tests := []struct {
+		backend gstorage.Backend
+		pub     crypto.PublicKey
+		ok      bool
+	}{
+		{ring, key.Public(), true},
+		{ring, other.Public(), false},
+	}
+	for i, test := range tests {
+		err := Checker{Iterations: 10, Seed: 1}.Backend(context.Background(), test.backend, test.pub)
+		switch {
+		case test.ok && err != nil:
+			t.Errorf("test %d expected no error, got: %v", i, err)
+		case !test.ok && err == nil:
+			t.Errorf("test %d expected error", i)
+		}
+	}
+}
+
+func TestURLSigner(t *testing.T) {
+	u, err := gstorage.NewURLSigner(func(u *gstorage.URLSigner) error {
+		u.PrivateKey, u.ClientEmail = loadTestKey(t), "test@example.com"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if err := (Checker{Iterations: 25}).URLSigner(u); err != nil {
+		t.Errorf("expected no error, got: %v", err)
+	}
+}
+
+func TestCanonicalization(t *testing.T) {
+	if err := (Checker{}).Canonicalization(); err != nil {
+		t.Errorf("expected no error, got: %v", err)
+	}
+}
+
+// brokenSigner is a crypto.Signer that mangles the signatures of the wrapped
+// signer, or returns an error when f is nil.
+type brokenSigner struct {
+	crypto.Signer
+	f func([]byte) []byte
+}
+
+// Sign satisfies the crypto.Signer interface.
+func (s brokenSigner) Sign(rnd io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if s.f == nil {
+		return nil, errors.New("broken signer")
+	}
+	sig, err := s.Signer.Sign(rnd, digest, opts)
+	if err != nil {
+		return nil, err
+	}
+	return s.f(sig), nil
+}
+
+// wrongKeySigner is a crypto.Signer that signs with a different key than the
+// public key it reports.
+type wrongKeySigner struct {
+	crypto.Signer
+	other crypto.Signer
+}
+
+// Sign satisfies the crypto.Signer interface.
+func (s wrongKeySigner) Sign(rnd io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.other.Sign(rnd, digest, opts)
+}
+
+// loadTestKey loads the test RSA private key.
+func loadTestKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	buf, err := ioutil.ReadFile("../testdata/key.pem")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	block, _ := pem.Decode(buf)
+	if block == nil {
+		t.Fatal("expected pem block in ../testdata/key.pem")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	return key.(*rsa.PrivateKey)
+}
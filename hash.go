@@ -0,0 +1,60 @@
+package gstorage
+
+import (
+	"crypto/md5"
+	"hash/crc32"
+	"io"
+)
+
+// castagnoli is the crc32c table.
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// HashReader reads r until EOF, returning the base64 encoded md5 hash of the
+// content, as used for the signing params' hash (and the Content-MD5 header),
+// and the number of bytes read. The content is streamed, and never buffered.
+func HashReader(r io.Reader) (string, int64, error) {
+	h := md5.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return "", n, err
+	}
+	return sum(h), n, nil
+}
+
+// CRC32C returns the base64 encoded crc32c (Castagnoli) checksum of buf, as
+// used for the signing params' crc32c checksum (and the x-goog-hash header).
+func CRC32C(buf []byte) string {
+	h := crc32.New(castagnoli)
+	_, _ = h.Write(buf)
+	return sum(h)
+}
+
+// CRC32CReader reads r until EOF, returning the base64 encoded crc32c
+// checksum of the content, and the number of bytes read. The content is
+// streamed, and never buffered.
+func CRC32CReader(r io.Reader) (string, int64, error) {
+	h := crc32.New(castagnoli)
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return "", n, err
+	}
+	return sum(h), n, nil
+}
+
+// UploadPathFor generates a signed URL for uploading the content of r to the
+// object, with the md5 hash of the content (see HashReader) included in the
+// signature. The client must send the returned headers, including the
+// Content-MD5 header, with the upload, so that content differing from r is
+// rejected.
+func (u *URLSigner) UploadPathFor(bucket, path string, r io.Reader) (*SignedURL, error) {
+	hash, _, err := HashReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return u.MakeSigned(&SigningParams{
+		Method: "PUT",
+		Hash:   hash,
+		Bucket: bucket,
+		Object: path,
+	}, u.defaultExpiration())
+}
@@ -0,0 +1,281 @@
+package gstorage
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	// MaxHeaders is the maximum number of extension headers of signing params,
+	// after combining multiple values.
+	MaxHeaders = 64
+
+	// MaxHeadersSize is the maximum combined size of the names and values of
+	// the extension headers of signing params.
+	MaxHeadersSize = 16 << 10
+
+	// MaxMetadataSize is the maximum combined size of the names (without the
+	// x-goog-meta- prefix) and values of custom object metadata.
+	MaxMetadataSize = 8 << 10
+)
+
+// header is a canonical header name and value pair.
+type header struct {
+	name  string
+	value string
+}
+
+// canonicalHeaders returns the canonical form of the extension headers,
+// sorted by name, as required for V2 and V4 signing (V2 signatures only
+// include the x-goog-* headers, see SigningParams.HeaderString):
+//
+//   - names are lowercased, and leading and trailing whitespace is removed
+//   - values have leading and trailing whitespace removed, and internal runs
+//     of whitespace folded to a single space
+//   - multiple values of a header, and values of headers whose names differ
+//     only by case, are combined into a single comma separated value, in the
+//     order of the original names and values
+//   - headers with empty names, and the customer-supplied encryption key
+//     headers, which are never signed, are excluded
+func canonicalHeaders(headers http.Header) []header {
+	if len(headers) == 0 {
+		return nil
+	}
+	// order original names, so values of headers differing only by case are
+	// combined in a consistent order
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var h []header
+	for _, k := range keys {
+		name := strings.ToLower(strings.TrimSpace(k))
+		if name == "" || isEncryptionKeyHeader(name) {
+			continue
+		}
+		for _, v := range headers[k] {
+			h = append(h, header{name, foldSpace(v)})
+		}
+	}
+	sort.SliceStable(h, func(i, j int) bool {
+		return h[i].name < h[j].name
+	})
+	// combine values of duplicate names
+	n := 0
+	for _, z := range h {
+		if n != 0 && h[n-1].name == z.name {
+			h[n-1].value += "," + z.value
+			continue
+		}
+		h[n] = z
+		n++
+	}
+	return h[:n]
+}
+
+// isExtensionHeader returns true when the lowercased name is a V2 canonical
+// extension header (ie, has the x-goog- prefix).
+func isExtensionHeader(name string) bool {
+	return strings.HasPrefix(name, "x-goog-")
+}
+
+// isEncryptionKeyHeader returns true when the lowercased name is one of the
+// customer-supplied encryption key headers.
+func isEncryptionKeyHeader(name string) bool {
+	return name == "x-goog-encryption-key" || name == "x-goog-encryption-key-sha256"
+}
+
+// foldSpace trims leading and trailing whitespace from s, and folds internal
+// runs of whitespace to a single space.
+func foldSpace(s string) string {
+	// fast path, when s has no leading, trailing, or repeated spaces, and no
+	// other whitespace
+	folded := true
+	for i := 0; i < len(s) && folded; i++ {
+		switch c := s[i]; {
+		case c == ' ':
+			folded = i != 0 && i != len(s)-1 && s[i+1] != ' '
+		case c == '\t' || c == '\n' || c == '\v' || c == '\f' || c == '\r' || c >= 0x80:
+			folded = false
+		}
+	}
+	if folded {
+		return s
+	}
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// validateHeaderValue validates that the value is safe for use as a header
+// value.
+func validateHeaderValue(value string) error {
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; c < ' ' || c > '~' {
+			return fmt.Errorf("invalid character %q", c)
+		}
+	}
+	return nil
+}
+
+// isTokenChar returns true when c is valid in a lowercased header name (RFC
+// 7230).
+func isTokenChar(c byte) bool {
+	if isAlnum(c) {
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-.^_`|~", c) != -1
+}
+
+// HeaderError is the error returned when signing params' headers contain a
+// header that cannot be signed.
+type HeaderError struct {
+	Header string
+	Reason string
+}
+
+// Error satisfies the error interface.
+func (err *HeaderError) Error() string {
+	return fmt.Sprintf("header %q: %s", err.Header, err.Reason)
+}
+
+// reservedHeaders are the headers that cannot be set as extension headers,
+// and the reason why.
+var reservedHeaders = map[string]string{
+	"authorization":       "signed urls cannot be used with authorization",
+	"date":                "not signed, use the signing params' expiration",
+	"x-goog-date":         "reserved for v4 signing",
+	"host":                "determined by the url",
+	"content-type":        "use the signing params' content type",
+	"content-md5":         "use the signing params' hash",
+	"content-length":      "set by the client",
+	"expect":              "set by the client",
+	"cookie":              "ignored by google cloud storage",
+	"connection":          "hop-by-hop header",
+	"keep-alive":          "hop-by-hop header",
+	"proxy-authorization": "hop-by-hop header",
+	"proxy-connection":    "hop-by-hop header",
+	"te":                  "hop-by-hop header",
+	"trailer":             "hop-by-hop header",
+	"transfer-encoding":   "hop-by-hop header",
+	"upgrade":             "hop-by-hop header",
+}
+
+// HeaderLimitError is the error returned when signing params' headers exceed
+// a limit (see MaxHeaders, MaxHeadersSize, and MaxMetadataSize).
+type HeaderLimitError struct {
+	Limit string
+	Size  int
+	Max   int
+}
+
+// Error satisfies the error interface.
+func (err *HeaderLimitError) Error() string {
+	return fmt.Sprintf("%s %d exceeds maximum %d", err.Limit, err.Size, err.Max)
+}
+
+// checkHeaders checks the signing params' headers do not contain reserved or
+// forbidden headers, returning a *HeaderError if they do, and do not exceed
+// the header limits, returning a *HeaderLimitError if they do.
+func (p SigningParams) checkHeaders() error {
+	for k := range p.Headers {
+		name := strings.ToLower(strings.TrimSpace(k))
+		if reason, ok := reservedHeaders[name]; ok {
+			return &HeaderError{Header: k, Reason: reason}
+		}
+	}
+	h := p.headers()
+	if len(h) > MaxHeaders {
+		return &HeaderLimitError{Limit: "header count", Size: len(h), Max: MaxHeaders}
+	}
+	var size, meta int
+	for _, z := range h {
+		size += len(z.name) + len(z.value)
+		if strings.HasPrefix(z.name, MetaPrefix) {
+			meta += len(z.name) - len(MetaPrefix) + len(z.value)
+		}
+	}
+	switch {
+	case size > MaxHeadersSize:
+		return &HeaderLimitError{Limit: "headers size", Size: size, Max: MaxHeadersSize}
+	case meta > MaxMetadataSize:
+		return &HeaderLimitError{Limit: "metadata size", Size: meta, Max: MaxMetadataSize}
+	}
+	return nil
+}
+
+// WithDefaultHeaders is an option that sets default headers (eg, x-goog-acl:
+// private), that are added to all signing params signed by the URLSigner,
+// unless the signing params have a header with the same name. Default
+// headers are signed (only x-goog-* headers, with V2 signatures), so clients
+// must send them (see SigningParams.RequiredHeaders).
+func WithDefaultHeaders(headers map[string]string) Option {
+	return func(u *URLSigner) error {
+		for k, v := range headers {
+			name := strings.ToLower(strings.TrimSpace(k))
+			if name == "" {
+				return errors.New("invalid default header: empty name")
+			}
+			for i := 0; i < len(name); i++ {
+				if !isTokenChar(name[i]) {
+					return &HeaderError{Header: k, Reason: fmt.Sprintf("invalid character %q", name[i])}
+				}
+			}
+			if reason, ok := reservedHeaders[name]; ok {
+				return &HeaderError{Header: k, Reason: reason}
+			}
+			if err := validateHeaderValue(v); err != nil {
+				return &HeaderError{Header: k, Reason: err.Error()}
+			}
+			if u.defaultHeaders == nil {
+				u.defaultHeaders = make(map[string]string)
+			}
+			u.defaultHeaders[name] = v
+		}
+		return nil
+	}
+}
+
+// setUploadHeader sets a header added to all uploads signed by the URLSigner.
+// The name must be lowercased.
+func (u *URLSigner) setUploadHeader(name, value string) {
+	if u.uploadHeaders == nil {
+		u.uploadHeaders = make(map[string]string)
+	}
+	u.uploadHeaders[name] = value
+}
+
+// withHeaders returns the signing params with the URLSigner's default headers
+// (see WithDefaultHeaders) added to the headers, when not already present,
+// and, for uploads (PUT and POST requests), with the URLSigner's upload
+// headers (see WithMeta and WithCacheControl) replacing any existing headers.
+// The signing params' headers are copied, and never modified.
+func (u *URLSigner) withHeaders(p SigningParams) SigningParams {
+	upload := strings.EqualFold(p.Method, "PUT") || strings.EqualFold(p.Method, "POST")
+	if len(u.defaultHeaders) == 0 && (!upload || len(u.uploadHeaders) == 0) {
+		return p
+	}
+	headers := make(http.Header, len(p.Headers)+len(u.defaultHeaders)+len(u.uploadHeaders))
+	present := make(map[string]bool, len(p.Headers))
+	for k, v := range p.Headers {
+		name := strings.ToLower(strings.TrimSpace(k))
+		if _, ok := u.uploadHeaders[name]; ok && upload {
+			continue
+		}
+		headers[k], present[name] = v, true
+	}
+	for k, v := range u.defaultHeaders {
+		if !present[k] {
+			headers[k] = []string{v}
+		}
+	}
+	if upload {
+		for k, v := range u.uploadHeaders {
+			headers[k] = []string{v}
+		}
+	}
+	p.Headers = headers
+	return p
+}
@@ -0,0 +1,278 @@
+package gstorage
+
+import (
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// refHeaderString is a straightforward reference implementation of
+// SigningParams.HeaderString, following the documented canonicalization
+// rules, and including only the x-goog-* headers.
+func refHeaderString(headers http.Header) string {
+	var keys []string
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	values := make(map[string][]string)
+	var names []string
+	for _, k := range keys {
+		name := strings.ToLower(strings.Trim(k, " \t"))
+		switch {
+		case !strings.HasPrefix(name, "x-goog-"),
+			name == "x-goog-encryption-key", name == "x-goog-encryption-key-sha256":
+			continue
+		}
+		if _, ok := values[name]; !ok {
+			names = append(names, name)
+		}
+		for _, v := range headers[k] {
+			// fold whitespace
+			var sb strings.Builder
+			space := false
+			for _, c := range strings.Trim(v, " \t") {
+				if c == ' ' || c == '\t' {
+					space = true
+					continue
+				}
+				if space {
+					sb.WriteByte(' ')
+					space = false
+				}
+				sb.WriteRune(c)
+			}
+			values[name] = append(values[name], sb.String())
+		}
+	}
+	sort.Strings(names)
+	var s string
+	for _, name := range names {
+		if len(values[name]) != 0 {
+			s += name + ":" + strings.Join(values[name], ",") + "\n"
+		}
+	}
+	return s
+}
+
+// randHeaders generates random extension headers, with names differing only
+// by case, surrounding and internal whitespace, and multiple values.
+func randHeaders(r *rand.Rand) http.Header {
+	names := []string{
+		"x-goog-meta-a", "X-Goog-Meta-A", "x-goog-meta-b", " x-goog-meta-c ",
+		"x-goog-acl", "X-GOOG-ACL", "x-goog-encryption-key", "x-goog-if-generation-match",
+		"cache-control", "Content-Disposition", "content-language",
+	}
+	words := []string{"a", "b", "private", "no-cache", "max-age=60", "1234", "x,y", "é"}
+	spaces := []string{"", " ", "  ", "\t", " \t "}
+	h := make(http.Header)
+	for i, n := 0, r.Intn(len(names)+1); i < n; i++ {
+		name := names[r.Intn(len(names))]
+		for j, m := 0, 1+r.Intn(3); j < m; j++ {
+			var sb strings.Builder
+			sb.WriteString(spaces[r.Intn(len(spaces))])
+			for k, l := 0, r.Intn(4); k < l; k++ {
+				if k != 0 {
+					sb.WriteString(" " + spaces[r.Intn(len(spaces))])
+				}
+				sb.WriteString(words[r.Intn(len(words))])
+			}
+			sb.WriteString(spaces[r.Intn(len(spaces))])
+			h[name] = append(h[name], sb.String())
+		}
+	}
+	return h
+}
+
+func TestHeaderString(t *testing.T) {
+	tests := []struct {
+		headers http.Header
+		exp     string
+	}{
+		{nil, ""},
+		{http.Header{"X-Goog-Meta-A": {"1"}}, "x-goog-meta-a:1\n"},
+		{http.Header{"x-goog-meta-b": {"2"}, "x-goog-meta-a": {"1"}}, "x-goog-meta-a:1\nx-goog-meta-b:2\n"},
+		{http.Header{"x-goog-meta-a": {"  a   b  "}}, "x-goog-meta-a:a b\n"},
+		{http.Header{"x-goog-meta-a": {"1", "2"}}, "x-goog-meta-a:1,2\n"},
+		{http.Header{"X-Goog-Meta-A": {"1"}, "x-goog-meta-a": {"2"}}, "x-goog-meta-a:1,2\n"},
+		{http.Header{" x-goog-meta-a ": {"1"}}, "x-goog-meta-a:1\n"},
+		{http.Header{"": {"1"}, "x-goog-encryption-key": {"k"}, "x-goog-encryption-key-sha256": {"h"}}, ""},
+		// v2 only signs x-goog-* extension headers
+		{http.Header{"Cache-Control": {"no-cache"}, "Content-Disposition": {"inline"}, "x-goog-acl": {"private"}}, "x-goog-acl:private\n"},
+		{http.Header{"cache-control": {"no-cache"}, "x-goog": {"1"}, "goog-meta-a": {"1"}}, ""},
+	}
+	for i, test := range tests {
+		if s := (SigningParams{Headers: test.headers}).HeaderString(); s != test.exp {
+			t.Errorf("test %d expected %q, got: %q", i, test.exp, s)
+		}
+	}
+}
+
+func TestHeaderStringReference(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		h := randHeaders(r)
+		exp := refHeaderString(h)
+		if s := (SigningParams{Headers: h}).HeaderString(); s != exp {
+			t.Fatalf("test %d headers %q expected:\n%q\ngot:\n%q", i, h, exp, s)
+		}
+	}
+}
+
+func BenchmarkHeaderString(b *testing.B) {
+	for _, n := range []int{0, 1, 4, 16, 64} {
+		h := make(http.Header, n)
+		for i := 0; i < n; i++ {
+			h["X-Goog-Meta-Key-"+strconv.Itoa(i)] = []string{" value  " + strconv.Itoa(i) + " "}
+		}
+		p := SigningParams{Headers: h}
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_ = p.HeaderString()
+			}
+		})
+	}
+}
+
+func BenchmarkString(b *testing.B) {
+	p := SigningParams{
+		Method:      "PUT",
+		Hash:        "rL0Y20zC+Fzt72VPzMSk2A==",
+		ContentType: "text/plain",
+		Headers: http.Header{
+			"X-Goog-Meta-Owner": {"test"},
+			"X-Goog-Acl":        {"private"},
+		},
+		Bucket: "bucket",
+		Object: "path/to/file.txt",
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = p.String()
+	}
+}
+
+func TestCanonicalHeaders(t *testing.T) {
+	tests := []struct {
+		headers http.Header
+		exp     []header
+	}{
+		{nil, nil},
+		{http.Header{}, nil},
+		// lowercasing
+		{http.Header{"X-Goog-ACL": {"private"}}, []header{{"x-goog-acl", "private"}}},
+		{http.Header{"CACHE-CONTROL": {"no-cache"}}, []header{{"cache-control", "no-cache"}}},
+		// trimming names and values
+		{http.Header{"\tx-goog-meta-a ": {"1"}}, []header{{"x-goog-meta-a", "1"}}},
+		{http.Header{"x-goog-meta-a": {" \t1\t "}}, []header{{"x-goog-meta-a", "1"}}},
+		{http.Header{"x-goog-meta-a": {""}}, []header{{"x-goog-meta-a", ""}}},
+		{http.Header{"x-goog-meta-a": {"   "}}, []header{{"x-goog-meta-a", ""}}},
+		// folding internal whitespace
+		{http.Header{"x-goog-meta-a": {"a  b"}}, []header{{"x-goog-meta-a", "a b"}}},
+		{http.Header{"x-goog-meta-a": {"a\tb"}}, []header{{"x-goog-meta-a", "a b"}}},
+		{http.Header{"x-goog-meta-a": {"a \t\r\n b"}}, []header{{"x-goog-meta-a", "a b"}}},
+		{http.Header{"x-goog-meta-a": {"a b c"}}, []header{{"x-goog-meta-a", "a b c"}}},
+		{http.Header{"x-goog-meta-a": {"é  ü"}}, []header{{"x-goog-meta-a", "é ü"}}},
+		// combining multiple values, in order
+		{http.Header{"x-goog-meta-a": {"2", "1"}}, []header{{"x-goog-meta-a", "2,1"}}},
+		{http.Header{"x-goog-meta-a": {"a,b", "c"}}, []header{{"x-goog-meta-a", "a,b,c"}}},
+		{http.Header{"x-goog-meta-a": {"", "1"}}, []header{{"x-goog-meta-a", ",1"}}},
+		// combining names differing by case or whitespace, in the order of
+		// the original names
+		{http.Header{"x-goog-meta-a": {"2"}, "X-Goog-Meta-A": {"1"}}, []header{{"x-goog-meta-a", "1,2"}}},
+		{http.Header{"x-goog-meta-a": {"3"}, "X-GOOG-META-A": {"1"}, "X-Goog-Meta-A": {"2"}}, []header{{"x-goog-meta-a", "1,2,3"}}},
+		{http.Header{"x-goog-meta-a": {"2"}, " x-goog-meta-a": {"1"}}, []header{{"x-goog-meta-a", "1,2"}}},
+		// sorting
+		{
+			http.Header{"x-goog-meta-b": {"2"}, "Content-Disposition": {"inline"}, "x-goog-meta-a": {"1"}, "x-goog-acl": {"private"}},
+			[]header{{"content-disposition", "inline"}, {"x-goog-acl", "private"}, {"x-goog-meta-a", "1"}, {"x-goog-meta-b", "2"}},
+		},
+		{
+			http.Header{"x-goog-meta-a-b": {"2"}, "x-goog-meta-a": {"1"}},
+			[]header{{"x-goog-meta-a", "1"}, {"x-goog-meta-a-b", "2"}},
+		},
+		// exclusion
+		{http.Header{"": {"1"}}, nil},
+		{http.Header{"  ": {"1"}}, nil},
+		{http.Header{"x-goog-encryption-key": {"k"}}, nil},
+		{http.Header{"X-Goog-Encryption-Key-Sha256": {"h"}}, nil},
+		{
+			http.Header{"x-goog-encryption-algorithm": {"AES256"}, "x-goog-encryption-key": {"k"}, "x-goog-encryption-key-sha256": {"h"}},
+			[]header{{"x-goog-encryption-algorithm", "AES256"}},
+		},
+		// headers with no values
+		{http.Header{"x-goog-meta-a": nil}, nil},
+		{http.Header{"x-goog-meta-a": nil, "x-goog-meta-b": {"1"}}, []header{{"x-goog-meta-b", "1"}}},
+	}
+	for i, test := range tests {
+		h := canonicalHeaders(test.headers)
+		if len(h) != len(test.exp) {
+			t.Errorf("test %d expected %v, got: %v", i, test.exp, h)
+			continue
+		}
+		for j := range h {
+			if h[j] != test.exp[j] {
+				t.Errorf("test %d expected %v, got: %v", i, test.exp, h)
+				break
+			}
+		}
+	}
+}
+
+func TestFoldSpace(t *testing.T) {
+	tests := []struct {
+		s, exp string
+	}{
+		{"", ""},
+		{" ", ""},
+		{"a", "a"},
+		{"a b", "a b"},
+		{" a", "a"},
+		{"a ", "a"},
+		{"a  b", "a b"},
+		{"a\tb", "a b"},
+		{"a\nb", "a b"},
+		{"a\vb", "a b"},
+		{"a\fb", "a b"},
+		{"a\rb", "a b"},
+		{"\t a \t b \t", "a b"},
+		{"é", "é"},
+		{"é  é", "é é"},
+		{"a\u00a0b", "a b"},
+		{"a\u2003b", "a b"},
+		{"a,b c", "a,b c"},
+	}
+	for i, test := range tests {
+		if s := foldSpace(test.s); s != test.exp {
+			t.Errorf("test %d expected %q, got: %q", i, test.exp, s)
+		}
+	}
+}
+
+func TestWithHeadersMethod(t *testing.T) {
+	u := &URLSigner{PrivateKey: loadTestKey(t), ClientEmail: "test@example.com"}
+	if err := WithMeta("source", "test")(u); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	tests := []struct {
+		method string
+		exp    bool
+	}{
+		{"PUT", true},
+		{"put", true},
+		{"POST", true},
+		{"Post", true},
+		{"GET", false},
+		{"delete", false},
+	}
+	for i, test := range tests {
+		p := u.withHeaders(SigningParams{Method: test.method, Bucket: "bucket", Object: "file.txt"})
+		if _, ok := p.RequiredHeaders()["X-Goog-Meta-Source"]; ok != test.exp {
+			t.Errorf("test %d expected upload headers for %s to be %t, got: %t", i, test.method, test.exp, ok)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package gstorage
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	b64 "encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Key is a private key with a validity window, for use with a KeyRing.
+type Key struct {
+	// ID is the key identifier, such as the private_key_id of Google Service
+	// Account credentials.
+	ID string
+
+	// Signer is the private key.
+	Signer crypto.Signer
+
+	// NotBefore is the time after which the key is used for signing.
+	NotBefore time.Time
+
+	// NotAfter is the time after which the key is no longer used for
+	// verification. If zero, then the key does not expire.
+	NotAfter time.Time
+}
+
+// valid returns true when the key is valid for verification at t.
+func (k Key) valid(t time.Time) bool {
+	return k.NotAfter.IsZero() || t.Before(k.NotAfter)
+}
+
+// KeyRing is a signing backend holding multiple keys with validity windows,
+// allowing for zero-downtime key rotation.
+//
+// Signatures are generated with the active key, which is the valid key with
+// the most recent NotBefore time that has passed. Signatures are verified
+// against all valid keys, so that URLs signed with a previous key remain
+// verifiable until that key's NotAfter time, even after a newer key has
+// become active.
+//
+// Note that all keys in a KeyRing must belong to the same service account.
+type KeyRing struct {
+	mu   sync.RWMutex
+	keys []Key
+}
+
+// NewKeyRing creates a new key ring for the keys.
+func NewKeyRing(keys ...Key) (*KeyRing, error) {
+	r := new(KeyRing)
+	for _, k := range keys {
+		if err := r.Add(k); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Add adds a key to the key ring.
+func (r *KeyRing) Add(k Key) error {
+	if k.Signer == nil {
+		return errors.New("key ring key missing signer")
+	}
+	if !k.NotAfter.IsZero() && !k.NotBefore.Before(k.NotAfter) {
+		return fmt.Errorf("key ring key %q has invalid validity window", k.ID)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys = append(r.keys, k)
+	sort.SliceStable(r.keys, func(i, j int) bool {
+		return r.keys[i].NotBefore.After(r.keys[j].NotBefore)
+	})
+	return nil
+}
+
+// Remove removes all keys with the key identifier from the key ring.
+func (r *KeyRing) Remove(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keys := r.keys[:0]
+	for _, k := range r.keys {
+		if k.ID != id {
+			keys = append(keys, k)
+		}
+	}
+	r.keys = keys
+}
+
+// Active returns the active key.
+func (r *KeyRing) Active() (Key, error) {
+	now := time.Now()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, k := range r.keys {
+		if !k.NotBefore.After(now) && k.valid(now) {
+			return k, nil
+		}
+	}
+	return Key{}, errors.New("key ring has no active key")
+}
+
+// SignBytes satisfies the Backend interface, signing buf with the active
+// key.
+func (r *KeyRing) SignBytes(_ context.Context, buf []byte) ([]byte, error) {
+	h := crypto.SHA256.New()
+	if _, err := h.Write(buf); err != nil {
+		return nil, err
+	}
+	return r.signDigestRand(rand.Reader, crypto.SHA256, h.Sum(nil))
+}
+
+// SignDigest satisfies the DigestSigner interface, signing the digest with
+// the active key.
+func (r *KeyRing) SignDigest(_ context.Context, hash crypto.Hash, digest []byte) ([]byte, error) {
+	return r.signDigestRand(rand.Reader, hash, digest)
+}
+
+// signDigestRand satisfies the localSigner interface, signing the digest
+// with the active key.
+func (r *KeyRing) signDigestRand(rnd io.Reader, hash crypto.Hash, digest []byte) ([]byte, error) {
+	k, err := r.Active()
+	if err != nil {
+		return nil, err
+	}
+	return k.Signer.Sign(rnd, digest, hash)
+}
+
+// VerifyBytes satisfies the Verifier interface, verifying that sig is a
+// signature of buf generated by any valid key.
+func (r *KeyRing) VerifyBytes(hash crypto.Hash, buf, sig []byte) error {
+	now := time.Now()
+	h := hash.New()
+	if _, err := h.Write(buf); err != nil {
+		return err
+	}
+	digest := h.Sum(nil)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, k := range r.keys {
+		if k.valid(now) && verifySignature(k.Signer.Public(), hash, digest, sig) == nil {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// Verifier is the interface for signing backends that can verify the
+// signatures they generate.
+type Verifier interface {
+	// VerifyBytes verifies that sig is a signature of buf, using the hash.
+	VerifyBytes(hash crypto.Hash, buf, sig []byte) error
+}
+
+// ErrInvalidSignature is the invalid signature error.
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// ErrSignatureExpired is the signature expired error.
+var ErrSignatureExpired error = &wrappedError{"signature expired", ErrExpired}
+
+// Verify verifies that the base64 encoded signature was generated for the
+// signing params by the URLSigner's private key, signer, or backend. The
+// backend must implement Verifier.
+//
+// The signing params are checked and canonicalized as when signing, so that
+// the URLSigner's default headers, name normalization, and canonicalizer are
+// applied to the verified string, and params not allowed by the URLSigner's
+// policies are rejected. The signing params are not modified.
+func (u *URLSigner) Verify(p *SigningParams, signature string) error {
+	if !p.Expiration.After(u.now()) {
+		return ErrSignatureExpired
+	}
+	sig, err := b64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	q := *p
+	if err := u.check(&q, false); err != nil {
+		return err
+	}
+	str, err := u.stringToSign(&q)
+	if err != nil {
+		return err
+	}
+	return u.verifyBytes([]byte(str), sig)
+}
+
+// verifyBytes verifies that sig is a signature of buf by the URLSigner's
+// private key, signer, or backend.
+func (u *URLSigner) verifyBytes(buf, sig []byte) error {
+	var pub crypto.PublicKey
+	switch {
+	case u.PrivateKey != nil:
+		pub = u.PrivateKey.Public()
+	case u.Signer != nil:
+		pub = u.Signer.Public()
+	case u.Backend != nil:
+		v, ok := u.Backend.(Verifier)
+		if !ok {
+			return errors.New("backend does not support verification")
+		}
+		return v.VerifyBytes(u.signatureHash(), buf, sig)
+	default:
+		return ErrMissingPrivateKey
+	}
+	hash := u.signatureHash()
+	h := hash.New()
+	if _, err := h.Write(buf); err != nil {
+		return err
+	}
+	return verifySignature(pub, hash, h.Sum(nil), sig)
+}
+
+// verifySignature verifies that sig is a signature of the digest generated
+// by the private key for the public key.
+func verifySignature(pub crypto.PublicKey, hash crypto.Hash, digest, sig []byte) error {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(k, hash, digest, sig) == nil {
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		if ecdsa.VerifyASN1(k, digest, sig) {
+			return nil
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", pub)
+	}
+	return ErrInvalidSignature
+}
@@ -0,0 +1,104 @@
+package gstorage
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	key := loadTestKey(t)
+	canonicalizer := CanonicalizerFunc(func(p *SigningParams) (string, error) {
+		return "custom\n" + p.String(), nil
+	})
+	tests := []struct {
+		name string
+		u    *URLSigner
+		opts []Option
+	}{
+		{"private key", &URLSigner{PrivateKey: key}, nil},
+		{"key backend", &URLSigner{Backend: newKeyBackend(key, "id")}, nil},
+		{"default headers", &URLSigner{PrivateKey: key}, []Option{WithDefaultHeaders(map[string]string{"x-goog-meta-source": "test"})}},
+		{"name normalizer", &URLSigner{PrivateKey: key}, []Option{WithNameNormalizer(strings.ToLower)}},
+		{"canonicalizer", &URLSigner{PrivateKey: key}, []Option{WithCanonicalizer(canonicalizer)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			u := test.u
+			u.ClientEmail = "test@example.com"
+			for _, o := range test.opts {
+				if err := o(u); err != nil {
+					t.Fatalf("expected no error, got: %v", err)
+				}
+			}
+			p := &SigningParams{
+				Method:     "PUT",
+				Bucket:     "bucket",
+				Object:     "Path/To/File.txt",
+				Expiration: time.Now().Add(time.Hour),
+			}
+			sig, err := u.SigningParams(p)
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if err := u.Verify(p, sig); err != nil {
+				t.Errorf("expected no error, got: %v", err)
+			}
+			q := *p
+			q.Method = "DELETE"
+			if err := u.Verify(&q, sig); err != ErrInvalidSignature {
+				t.Errorf("expected ErrInvalidSignature, got: %v", err)
+			}
+			q = *p
+			q.Expiration = time.Now().Add(-time.Minute)
+			if err := u.Verify(&q, sig); !errors.Is(err, ErrExpired) {
+				t.Errorf("expected ErrExpired, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestKeyRingVerify(t *testing.T) {
+	prev, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	next := loadTestKey(t)
+	now := time.Now()
+	r, err := NewKeyRing(
+		Key{ID: "prev", Signer: prev, NotBefore: now.Add(-2 * time.Hour), NotAfter: now.Add(time.Hour)},
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	u := &URLSigner{Backend: r, ClientEmail: "test@example.com"}
+	p := &SigningParams{
+		Method:     "GET",
+		Bucket:     "bucket",
+		Object:     "file.txt",
+		Expiration: now.Add(time.Hour),
+	}
+	sig, err := u.SigningParams(p)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	// rotate
+	if err := r.Add(Key{ID: "next", Signer: next, NotBefore: now.Add(-time.Hour)}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if k, err := r.Active(); err != nil || k.ID != "next" {
+		t.Fatalf("expected active key next, got: %q, %v", k.ID, err)
+	}
+	if err := u.Verify(p, sig); err != nil {
+		t.Errorf("expected signature by previous key to verify, got: %v", err)
+	}
+	// retire
+	r.Remove("prev")
+	if err := u.Verify(p, sig); err != ErrInvalidSignature {
+		t.Errorf("expected ErrInvalidSignature, got: %v", err)
+	}
+}
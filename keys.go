@@ -0,0 +1,236 @@
+package gstorage
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// parsePrivateKey parses a PEM or DER encoded private key, detecting whether
+// the key is a PKCS#1, PKCS#8, or EC (SEC 1) private key.
+func parsePrivateKey(buf []byte) (crypto.Signer, error) {
+	if block, _ := pem.Decode(buf); block != nil {
+		if x509.IsEncryptedPEMBlock(block) || block.Type == "ENCRYPTED PRIVATE KEY" {
+			return nil, fmt.Errorf("detected encrypted private key (%s), a passphrase is required", block.Type)
+		}
+		return parsePrivateKeyBlock(block.Type, block.Bytes)
+	}
+	// detect der format
+	if key, err := x509.ParsePKCS8PrivateKey(buf); err == nil {
+		return signerFor(key, "PKCS#8")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(buf); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(buf); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("private key is not a PEM encoded key, nor a PKCS#1, PKCS#8, or EC DER encoded key")
+}
+
+// parsePrivateKeyBlock parses the DER encoded private key of a PEM block of
+// the specified type.
+func parsePrivateKeyBlock(typ string, der []byte) (crypto.Signer, error) {
+	switch typ {
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("detected PKCS#1 private key, but could not parse: %v", err)
+		}
+		return key, nil
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("detected PKCS#8 private key, but could not parse: %v", err)
+		}
+		return signerFor(key, "PKCS#8")
+	case "EC PRIVATE KEY":
+		key, err := x509.ParseECPrivateKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("detected EC private key, but could not parse: %v", err)
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported PEM block type %q", typ)
+}
+
+// signerFor returns the private key as a crypto.Signer.
+func signerFor(key crypto.PrivateKey, format string) (crypto.Signer, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("detected %s private key of type %T, which cannot be used for signing", format, key)
+	}
+	return signer, nil
+}
+
+// setKey sets the URLSigner's private key, using PrivateKey for RSA keys and
+// Signer otherwise.
+func (u *URLSigner) setKey(key crypto.Signer) {
+	if k, ok := key.(*rsa.PrivateKey); ok {
+		u.PrivateKey, u.Signer = k, nil
+	} else {
+		u.PrivateKey, u.Signer = nil, key
+	}
+	u.keyID = ""
+}
+
+// localSigner is the interface for signing backends holding local keys, that
+// sign digests with the URLSigner's random source.
+type localSigner interface {
+	signDigestRand(rnd io.Reader, hash crypto.Hash, digest []byte) ([]byte, error)
+}
+
+// keyBackend is a signing backend using a local private key that can be
+// atomically swapped, for keys that are rotated while in use.
+type keyBackend struct {
+	key atomic.Value
+}
+
+// newKeyBackend creates a key backend for the private key and key id.
+func newKeyBackend(key crypto.Signer, keyID string) *keyBackend {
+	b := new(keyBackend)
+	b.swap(key, keyID)
+	return b
+}
+
+// swap swaps the private key and key id.
+func (b *keyBackend) swap(key crypto.Signer, keyID string) {
+	b.key.Store(&Key{ID: keyID, Signer: key})
+}
+
+// current returns the current key.
+func (b *keyBackend) current() *Key {
+	return b.key.Load().(*Key)
+}
+
+// SignBytes satisfies the Backend interface.
+func (b *keyBackend) SignBytes(ctx context.Context, buf []byte) ([]byte, error) {
+	h := crypto.SHA256.New()
+	if _, err := h.Write(buf); err != nil {
+		return nil, err
+	}
+	return b.SignDigest(ctx, crypto.SHA256, h.Sum(nil))
+}
+
+// SignDigest satisfies the DigestSigner interface.
+func (b *keyBackend) SignDigest(_ context.Context, hash crypto.Hash, digest []byte) ([]byte, error) {
+	return b.signDigestRand(rand.Reader, hash, digest)
+}
+
+// signDigestRand satisfies the localSigner interface.
+func (b *keyBackend) signDigestRand(rnd io.Reader, hash crypto.Hash, digest []byte) ([]byte, error) {
+	return b.current().Signer.Sign(rnd, digest, hash)
+}
+
+// VerifyBytes satisfies the Verifier interface, verifying that sig is a
+// signature of buf generated by the current key.
+func (b *keyBackend) VerifyBytes(hash crypto.Hash, buf, sig []byte) error {
+	h := hash.New()
+	if _, err := h.Write(buf); err != nil {
+		return err
+	}
+	return verifySignature(b.current().Signer.Public(), hash, h.Sum(nil), sig)
+}
+
+// checkKey checks that a RSA private key is at least the URLSigner's minimum
+// key size.
+func (u *URLSigner) checkKey(key crypto.Signer) error {
+	return checkKeyBits(key, u.minKeyBits)
+}
+
+// checkKeyBits checks that a RSA private key is at least min bits, or
+// DefaultMinRSAKeyBits when min is 0.
+func checkKeyBits(key crypto.Signer, min int) error {
+	pub, ok := key.Public().(*rsa.PublicKey)
+	if !ok {
+		return nil
+	}
+	if min == 0 {
+		min = DefaultMinRSAKeyBits
+	}
+	if bits := pub.N.BitLen(); bits < min {
+		return fmt.Errorf("rsa private key is %d bits, minimum is %d bits", bits, min)
+	}
+	return nil
+}
+
+// KeyInfo is information about a URLSigner's signing key, for correlating
+// generated URLs with Google Cloud audit logs.
+type KeyInfo struct {
+	// ClientEmail is the client email.
+	ClientEmail string
+
+	// KeyID is the private key id (ie, the credentials' private_key_id), if
+	// known.
+	KeyID string
+
+	// Fingerprint is the hex encoded SHA-256 fingerprint of the DER encoded
+	// public key, if known.
+	Fingerprint string
+}
+
+// String satisfies the fmt.Stringer interface.
+func (info KeyInfo) String() string {
+	s := info.ClientEmail
+	if info.KeyID != "" {
+		s += " key_id=" + info.KeyID
+	}
+	if info.Fingerprint != "" {
+		s += " fingerprint=" + info.Fingerprint
+	}
+	return s
+}
+
+// KeyInfo returns information about the URLSigner's current signing key.
+//
+// The key id and fingerprint are not available for remote signing backends.
+func (u *URLSigner) KeyInfo() KeyInfo {
+	info := KeyInfo{ClientEmail: u.ClientEmail}
+	var pub crypto.PublicKey
+	switch {
+	case u.PrivateKey != nil:
+		info.KeyID, pub = u.keyID, u.PrivateKey.Public()
+	case u.Signer != nil:
+		info.KeyID, pub = u.keyID, u.Signer.Public()
+	default:
+		switch b := u.Backend.(type) {
+		case *keyBackend:
+			k := b.current()
+			info.KeyID, pub = k.ID, k.Signer.Public()
+		case *KeyRing:
+			if k, err := b.Active(); err == nil {
+				info.KeyID, pub = k.ID, k.Signer.Public()
+			}
+		case *lazyBackend:
+			if l := b.loaded(); l != nil {
+				return l.KeyInfo()
+			}
+		case *scopedBackend:
+			return b.u.KeyInfo()
+		}
+	}
+	if pub != nil {
+		info.Fingerprint = fingerprint(pub)
+	}
+	return info
+}
+
+// fingerprint returns the hex encoded SHA-256 fingerprint of the DER encoded
+// public key.
+func fingerprint(pub crypto.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
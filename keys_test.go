@@ -0,0 +1,70 @@
+package gstorage
+
+import (
+	"bytes"
+	"crypto"
+	"io"
+	"testing"
+	"time"
+)
+
+// randSigner is a crypto.Signer recording the random source used for
+// signing.
+type randSigner struct {
+	crypto.Signer
+	rand io.Reader
+}
+
+// Sign satisfies the crypto.Signer interface.
+func (s *randSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	s.rand = rand
+	return s.Signer.Sign(rand, digest, opts)
+}
+
+func TestKeyBackendRand(t *testing.T) {
+	key := loadTestKey(t)
+	tests := []struct {
+		name    string
+		backend func(crypto.Signer) Backend
+	}{
+		{"key backend", func(s crypto.Signer) Backend {
+			return newKeyBackend(s, "id")
+		}},
+		{"key ring", func(s crypto.Signer) Backend {
+			r, err := NewKeyRing(Key{ID: "id", Signer: s, NotBefore: time.Now().Add(-time.Hour)})
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			return r
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &randSigner{Signer: key}
+			rnd := bytes.NewReader(make([]byte, 1024))
+			u := &URLSigner{Backend: test.backend(s), ClientEmail: "test@example.com"}
+			if err := WithRand(rnd)(u); err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			p := &SigningParams{
+				Method:     "GET",
+				Bucket:     "bucket",
+				Object:     "file.txt",
+				Expiration: time.Now().Add(time.Hour),
+			}
+			if _, err := u.SigningParams(p); err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if s.rand != rnd {
+				t.Errorf("expected signing with the URLSigner's random source, got: %T", s.rand)
+			}
+			s.rand = nil
+			if _, err := u.SignDigest(p.Digest(crypto.SHA256)); err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if s.rand != rnd {
+				t.Errorf("expected digest signing with the URLSigner's random source, got: %T", s.rand)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package gstorage
+
+import (
+	"context"
+	"sync"
+)
+
+// WithLazyCredentials is an option that defers loading credentials until the
+// URLSigner is first used, such as when the metadata server is not available
+// while a program initializes.
+//
+// On first use, a URLSigner is created with the options, and is used for
+// generating signatures. When the client email (or access id) is not
+// otherwise set, then the client email of the created URLSigner is used. If
+// creating the URLSigner fails, then creation is retried on next use.
+func WithLazyCredentials(opts ...Option) Option {
+	return func(u *URLSigner) error {
+		u.PrivateKey, u.Signer, u.Backend = nil, nil, &lazyBackend{opts: opts}
+		return nil
+	}
+}
+
+// lazyBackend is a signing backend that creates a URLSigner on first use.
+type lazyBackend struct {
+	opts []Option
+	mu   sync.Mutex
+	u    *URLSigner
+}
+
+// get returns the URLSigner, creating it if not already created.
+func (b *lazyBackend) get() (*URLSigner, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.u == nil {
+		u, err := NewURLSigner(b.opts...)
+		if err != nil {
+			return nil, err
+		}
+		b.u = u
+	}
+	return b.u, nil
+}
+
+// loaded returns the URLSigner if it has been created.
+func (b *lazyBackend) loaded() *URLSigner {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.u
+}
+
+// SignBytes satisfies the Backend interface.
+func (b *lazyBackend) SignBytes(ctx context.Context, buf []byte) ([]byte, error) {
+	u, err := b.get()
+	if err != nil {
+		return nil, err
+	}
+	return u.sign(ctx, buf)
+}
+
+// Ping checks that the URLSigner can generate signatures, loading deferred
+// credentials (see WithLazyCredentials) and exercising remote signing
+// backends.
+func (u *URLSigner) Ping(ctx context.Context) error {
+	_, err := u.sign(ctx, []byte("ping"))
+	return err
+}
@@ -0,0 +1,38 @@
+package gstorage
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestWithLazyCredentials(t *testing.T) {
+	tests := []struct {
+		scheme SigningScheme
+		param  string
+	}{
+		{SigningSchemeV2, "GoogleAccessId"},
+		{SigningSchemeV4, "X-Goog-Credential"},
+	}
+	for i, test := range tests {
+		u, err := NewURLSigner(
+			WithLazyCredentials(WithCredentialsJSON(testCredentialsJSON(t))),
+			WithSigningScheme(test.scheme),
+		)
+		if err != nil {
+			t.Fatalf("test %d expected no error, got: %v", i, err)
+		}
+		// first use loads the credentials
+		urlstr, err := u.DownloadPath("bucket", "file.txt")
+		if err != nil {
+			t.Fatalf("test %d expected no error, got: %v", i, err)
+		}
+		v, err := url.Parse(urlstr)
+		if err != nil {
+			t.Fatalf("test %d expected no error, got: %v", i, err)
+		}
+		if s := v.Query().Get(test.param); !strings.HasPrefix(s, "test@example.iam.gserviceaccount.com") {
+			t.Errorf("test %d expected %s for the loaded client email, got: %q", i, test.param, s)
+		}
+	}
+}
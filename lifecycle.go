@@ -0,0 +1,186 @@
+package gstorage
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lifecycleConfig is a XML API bucket lifecycle configuration. The action of
+// a rule is an element named for the action type, such as <Delete/> or
+// <SetStorageClass>NEARLINE</SetStorageClass>.
+type lifecycleConfig struct {
+	Rules []struct {
+		Action struct {
+			Delete          *struct{} `xml:"Delete"`
+			SetStorageClass string    `xml:"SetStorageClass"`
+		} `xml:"Action"`
+		Condition struct {
+			Age                   *int     `xml:"Age"`
+			CreatedBefore         string   `xml:"CreatedBefore"`
+			MatchesPrefix         []string `xml:"MatchesPrefix"`
+			MatchesSuffix         []string `xml:"MatchesSuffix"`
+			NumberOfNewerVersions *int     `xml:"NumberOfNewerVersions"`
+			IsLive                *bool    `xml:"IsLive"`
+			MatchesStorageClass   []string `xml:"MatchesStorageClass"`
+			DaysSinceNoncurrent   *int     `xml:"DaysSinceNoncurrentTime"`
+			NoncurrentTimeBefore  string   `xml:"NoncurrentTimeBefore"`
+			DaysSinceCustomTime   *int     `xml:"DaysSinceCustomTime"`
+			CustomTimeBefore      string   `xml:"CustomTimeBefore"`
+		} `xml:"Condition"`
+	} `xml:"Rule"`
+}
+
+// ObjectLifetime returns the earliest time the object may be deleted by the
+// bucket's lifecycle configuration, retrieved using a signed GET on the
+// bucket's lifecycle subresource. A zero time is returned when no lifecycle
+// delete rule applies to the object.
+//
+// Only delete rules with Age, CreatedBefore, MatchesPrefix, and MatchesSuffix
+// conditions are considered, as the remaining conditions depend on state
+// that cannot be predicted. Note that lifecycle deletion is asynchronous, and
+// objects may remain available for some time after the returned time.
+func (u *URLSigner) ObjectLifetime(ctx context.Context, bucket, path string) (time.Time, error) {
+	// retrieve lifecycle config
+	var config lifecycleConfig
+	if err := u.getXML(ctx, &SigningParams{Method: "GET", Bucket: bucket, Subresource: "lifecycle"}, &config); err != nil {
+		return time.Time{}, fmt.Errorf("could not retrieve lifecycle configuration: %v", err)
+	}
+	var created time.Time
+	var lifetime time.Time
+	object := strings.TrimPrefix(path, "/")
+	for _, rule := range config.Rules {
+		c := rule.Condition
+		switch {
+		case rule.Action.Delete == nil,
+			c.Age == nil && c.CreatedBefore == "",
+			c.NumberOfNewerVersions != nil, c.IsLive != nil && !*c.IsLive,
+			len(c.MatchesStorageClass) != 0, c.DaysSinceNoncurrent != nil,
+			c.NoncurrentTimeBefore != "", c.DaysSinceCustomTime != nil,
+			c.CustomTimeBefore != "",
+			len(c.MatchesPrefix) != 0 && !hasAnyPrefix(object, c.MatchesPrefix),
+			len(c.MatchesSuffix) != 0 && !hasAnySuffix(object, c.MatchesSuffix):
+			continue
+		}
+		// retrieve object creation time
+		if created.IsZero() {
+			var err error
+			if created, err = u.objectCreated(ctx, bucket, path); err != nil {
+				return time.Time{}, err
+			}
+		}
+		// conditions are combined, so deletion occurs once all are met
+		var t time.Time
+		if c.Age != nil {
+			t = created.AddDate(0, 0, *c.Age)
+		}
+		if c.CreatedBefore != "" {
+			before, err := time.Parse("2006-01-02", c.CreatedBefore)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid lifecycle created before %q", c.CreatedBefore)
+			}
+			if !created.Before(before) {
+				continue
+			}
+			if t.IsZero() {
+				t = created
+			}
+		}
+		if lifetime.IsZero() || t.Before(lifetime) {
+			lifetime = t
+		}
+	}
+	return lifetime, nil
+}
+
+// ClampExpiration clamps the duration d to the object's remaining lifetime
+// (see ObjectLifetime), returning the clamped duration and whether the
+// duration was clamped, so that signed URLs do not outlive the object.
+func (u *URLSigner) ClampExpiration(ctx context.Context, bucket, path string, d time.Duration) (time.Duration, bool, error) {
+	lifetime, err := u.ObjectLifetime(ctx, bucket, path)
+	if err != nil {
+		return 0, false, err
+	}
+	if lifetime.IsZero() {
+		return d, false, nil
+	}
+	if remaining := lifetime.Sub(u.now()); remaining < d {
+		if remaining < 0 {
+			remaining = 0
+		}
+		return remaining, true, nil
+	}
+	return d, false, nil
+}
+
+// objectCreated returns the object's creation time, using a signed HEAD
+// request.
+func (u *URLSigner) objectCreated(ctx context.Context, bucket, path string) (time.Time, error) {
+	urlstr, err := u.MakeContext(ctx, &SigningParams{Method: "HEAD", Bucket: bucket, Object: path}, DefaultExpiration)
+	if err != nil {
+		return time.Time{}, err
+	}
+	req, err := http.NewRequest("HEAD", urlstr, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	res, err := u.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer drain(res)
+	if res.StatusCode != http.StatusOK {
+		return time.Time{}, fmt.Errorf("could not retrieve /%s/%s: %s", bucket, strings.TrimPrefix(path, "/"), res.Status)
+	}
+	// generations are the creation time in microseconds
+	if gen, err := strconv.ParseInt(res.Header.Get("x-goog-generation"), 10, 64); err == nil {
+		return time.Unix(0, gen*int64(time.Microsecond)), nil
+	}
+	return http.ParseTime(res.Header.Get("Last-Modified"))
+}
+
+// getXML performs a signed request for the signing params, decoding the XML
+// response into v.
+func (u *URLSigner) getXML(ctx context.Context, p *SigningParams, v interface{}) error {
+	urlstr, err := u.MakeContext(ctx, p, DefaultExpiration)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(p.Method, urlstr, nil)
+	if err != nil {
+		return err
+	}
+	res, err := u.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer drain(res)
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: %s", p.Method, p.CanonicalResource(), res.Status)
+	}
+	return xml.NewDecoder(res.Body).Decode(v)
+}
+
+// hasAnyPrefix returns true when s has any of the prefixes.
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAnySuffix returns true when s has any of the suffixes.
+func hasAnySuffix(s string, suffixes []string) bool {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(s, suffix) {
+			return true
+		}
+	}
+	return false
+}
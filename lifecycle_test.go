@@ -0,0 +1,95 @@
+package gstorage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testLifecycleConfig is a bucket lifecycle configuration, as returned by the
+// XML API.
+const testLifecycleConfig = `<?xml version="1.0" encoding="UTF-8"?>
+<LifecycleConfiguration>
+    <Rule>
+        <Action>
+            <SetStorageClass>NEARLINE</SetStorageClass>
+        </Action>
+        <Condition>
+            <Age>1</Age>
+        </Condition>
+    </Rule>
+    <Rule>
+        <Action>
+            <Delete/>
+        </Action>
+        <Condition>
+            <Age>30</Age>
+            <MatchesPrefix>logs/</MatchesPrefix>
+        </Condition>
+    </Rule>
+    <Rule>
+        <Action>
+            <Delete/>
+        </Action>
+        <Condition>
+            <Age>7</Age>
+            <MatchesPrefix>tmp/</MatchesPrefix>
+        </Condition>
+    </Rule>
+    <Rule>
+        <Action>
+            <Delete/>
+        </Action>
+        <Condition>
+            <NumberOfNewerVersions>3</NumberOfNewerVersions>
+        </Condition>
+    </Rule>
+    <Rule>
+        <Action>
+            <AbortIncompleteMultipartUpload/>
+        </Action>
+        <Condition>
+            <Age>2</Age>
+        </Condition>
+    </Rule>
+</LifecycleConfiguration>`
+
+func TestObjectLifetime(t *testing.T) {
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.Method == "GET" && req.URL.Path == "/bucket/" && req.URL.Query()["lifecycle"] != nil:
+			w.Header().Set("Content-Type", "application/xml")
+			_, _ = w.Write([]byte(testLifecycleConfig))
+		case req.Method == "HEAD":
+			w.Header().Set("x-goog-generation", strconv.FormatInt(created.UnixNano()/int64(time.Microsecond), 10))
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer s.Close()
+	u := &URLSigner{PrivateKey: loadTestKey(t), ClientEmail: "test@example.com"}
+	if err := WithBaseURL(s.URL)(u); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	tests := []struct {
+		path string
+		exp  time.Time
+	}{
+		{"logs/a.log", created.AddDate(0, 0, 30)},
+		{"tmp/a.txt", created.AddDate(0, 0, 7)},
+		{"data/a.txt", time.Time{}},
+	}
+	for i, test := range tests {
+		lifetime, err := u.ObjectLifetime(context.Background(), "bucket", test.path)
+		if err != nil {
+			t.Fatalf("test %d expected no error, got: %v", i, err)
+		}
+		if !lifetime.Equal(test.exp) {
+			t.Errorf("test %d expected %v, got: %v", i, test.exp, lifetime)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package gstorage
+
+import (
+	"context"
+	b64 "encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ListOptions are the bucket listing options for signed list URLs.
+type ListOptions struct {
+	// Prefix restricts the listing to objects with names beginning with the
+	// prefix.
+	Prefix string
+
+	// Delimiter groups objects with names containing the delimiter after the
+	// prefix into common prefixes (eg, /).
+	Delimiter string
+
+	// MaxKeys is the maximum number of objects listed. If 0, then the
+	// service's default is used.
+	MaxKeys int
+
+	// Marker starts the listing after the object with the name.
+	Marker string
+}
+
+// query returns the listing query parameters for the options.
+func (opts ListOptions) query() url.Values {
+	q := url.Values{}
+	if opts.Prefix != "" {
+		q.Set("prefix", opts.Prefix)
+	}
+	if opts.Delimiter != "" {
+		q.Set("delimiter", opts.Delimiter)
+	}
+	if opts.MaxKeys != 0 {
+		q.Set("max-keys", strconv.Itoa(opts.MaxKeys))
+	}
+	if opts.Marker != "" {
+		q.Set("marker", opts.Marker)
+	}
+	return q
+}
+
+// ListURL creates a signed URL for listing the bucket's objects with the
+// listing options, such as for untrusted clients listing a constrained
+// subtree of a bucket.
+//
+// As V2 signatures do not include query parameters, ListURL always generates
+// V4 signed URLs, so the listing options cannot be altered by the client.
+func (u *URLSigner) ListURL(bucket string, opts ListOptions, d time.Duration) (string, error) {
+	s := *u
+	s.scheme = SigningSchemeV4
+	return s.Make(&SigningParams{
+		Method:      "GET",
+		Bucket:      bucket,
+		Subresource: canonicalQuery(opts.query()),
+	}, d)
+}
+
+// ObjectInfo holds information about a storage object.
+type ObjectInfo struct {
+	// Bucket is the storage bucket.
+	Bucket string
+
+	// Name is the object name.
+	Name string
+
+	// Size is the object size.
+	Size int64
+
+	// ETag is the object etag.
+	ETag string
+
+	// Generation is the object generation.
+	Generation int64
+
+	// LastModified is the last modified time of the object.
+	LastModified time.Time
+}
+
+// listResult is a XML API bucket listing result.
+type listResult struct {
+	Name        string `xml:"Name"`
+	Prefix      string `xml:"Prefix"`
+	Marker      string `xml:"Marker"`
+	NextMarker  string `xml:"NextMarker"`
+	IsTruncated bool   `xml:"IsTruncated"`
+	Contents    []struct {
+		Key          string    `xml:"Key"`
+		Generation   int64     `xml:"Generation"`
+		LastModified time.Time `xml:"LastModified"`
+		ETag         string    `xml:"ETag"`
+		Size         int64     `xml:"Size"`
+	} `xml:"Contents"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+}
+
+// list retrieves a single page of the bucket listing using a signed URL.
+func (u *URLSigner) list(ctx context.Context, bucket, prefix, delimiter, marker string) (*listResult, error) {
+	urlstr, err := u.ListURL(bucket, ListOptions{
+		Prefix:    prefix,
+		Delimiter: delimiter,
+		Marker:    marker,
+	}, DefaultExpiration)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", urlstr, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := u.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer drain(res)
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not list bucket %s: %s", bucket, res.Status)
+	}
+	v := new(listResult)
+	if err := xml.NewDecoder(res.Body).Decode(v); err != nil {
+		return nil, fmt.Errorf("could not decode bucket %s listing: %v", bucket, err)
+	}
+	return v, nil
+}
+
+// listAll retrieves all objects in the bucket having the prefix, calling f
+// for each object.
+func (u *URLSigner) listAll(ctx context.Context, bucket, prefix string, f func(ObjectInfo) error) error {
+	var marker string
+	for {
+		objs, next, err := u.listPage(ctx, bucket, prefix, marker)
+		if err != nil {
+			return err
+		}
+		for _, obj := range objs {
+			if err := f(obj); err != nil {
+				return err
+			}
+		}
+		if next == "" {
+			return nil
+		}
+		marker = next
+	}
+}
+
+// listPage retrieves a single page of objects in the bucket having the
+// prefix, returning the objects and the marker for the next page (if any).
+func (u *URLSigner) listPage(ctx context.Context, bucket, prefix, marker string) ([]ObjectInfo, string, error) {
+	v, err := u.list(ctx, bucket, prefix, "", marker)
+	if err != nil {
+		return nil, "", err
+	}
+	objs := make([]ObjectInfo, 0, len(v.Contents))
+	for _, c := range v.Contents {
+		objs = append(objs, ObjectInfo{
+			Bucket:       bucket,
+			Name:         c.Key,
+			Size:         c.Size,
+			ETag:         c.ETag,
+			Generation:   c.Generation,
+			LastModified: c.LastModified,
+		})
+	}
+	if !v.IsTruncated || len(v.Contents) == 0 {
+		return objs, "", nil
+	}
+	next := v.NextMarker
+	if next == "" {
+		next = v.Contents[len(v.Contents)-1].Key
+	}
+	return objs, next, nil
+}
+
+// ListPage retrieves a single page of objects in the bucket having the
+// prefix, starting from the resume token returned by a previous call (or
+// from the beginning when token is empty). The returned resume token is empty
+// when there are no more objects.
+//
+// Resume tokens are opaque, and can be persisted to checkpoint and resume
+// large listings across process restarts.
+func (u *URLSigner) ListPage(ctx context.Context, bucket, prefix, token string) ([]ObjectInfo, string, error) {
+	marker, err := decodeResumeToken(token, "list", bucket+"/"+prefix)
+	if err != nil {
+		return nil, "", err
+	}
+	objs, next, err := u.listPage(ctx, bucket, prefix, marker)
+	if err != nil {
+		return nil, "", err
+	}
+	return objs, encodeResumeToken("list", bucket+"/"+prefix, next), nil
+}
+
+// resumeToken is a resume token for a bulk operation.
+type resumeToken struct {
+	Op     string `json:"o"`
+	Key    string `json:"k"`
+	Marker string `json:"m"`
+}
+
+// encodeResumeToken encodes a resume token for the operation, operation key,
+// and marker. An empty string is returned when the marker is empty.
+func encodeResumeToken(op, key, marker string) string {
+	if marker == "" {
+		return ""
+	}
+	buf, err := json.Marshal(resumeToken{Op: op, Key: key, Marker: marker})
+	if err != nil {
+		return ""
+	}
+	return b64.RawURLEncoding.EncodeToString(buf)
+}
+
+// decodeResumeToken decodes a resume token, returning its marker, and
+// checking that the token was issued for the operation and operation key.
+func decodeResumeToken(token, op, key string) (string, error) {
+	if token == "" {
+		return "", nil
+	}
+	buf, err := b64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", errors.New("invalid resume token")
+	}
+	var t resumeToken
+	if err := json.Unmarshal(buf, &t); err != nil || t.Marker == "" {
+		return "", errors.New("invalid resume token")
+	}
+	if t.Op != op || t.Key != key {
+		return "", errors.New("resume token was issued for a different operation")
+	}
+	return t.Marker, nil
+}
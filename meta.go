@@ -0,0 +1,51 @@
+package gstorage
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MetaPrefix is the header name prefix of custom object metadata.
+const MetaPrefix = "x-goog-meta-"
+
+// WithMeta is an option that adds custom object metadata to all uploads (PUT
+// and POST requests) signed by the URLSigner, as the x-goog-meta-<key>
+// header. The metadata is signed, so clients must send it (see
+// SigningParams.RequiredHeaders), and objects uploaded using signed URLs will
+// always carry it. Metadata set by the option replaces any metadata with the
+// same key in the signing params.
+//
+// The key may be supplied with or without the x-goog-meta- prefix, and must
+// consist only of letters, digits, and the characters ! # $ % & ' * + - . ^ _
+// ` | ~. The value must consist only of printable ASCII characters.
+func WithMeta(key, value string) Option {
+	return func(u *URLSigner) error {
+		name, err := metaName(key)
+		if err != nil {
+			return err
+		}
+		if err := validateHeaderValue(value); err != nil {
+			return fmt.Errorf("invalid metadata %q: %v", key, err)
+		}
+		u.setUploadHeader(name, value)
+		return nil
+	}
+}
+
+// metaName returns the lowercased x-goog-meta- header name for the metadata
+// key.
+func metaName(key string) (string, error) {
+	name := strings.ToLower(strings.TrimSpace(key))
+	if !strings.HasPrefix(name, MetaPrefix) {
+		name = MetaPrefix + name
+	}
+	if name == MetaPrefix {
+		return "", fmt.Errorf("invalid metadata key %q: empty", key)
+	}
+	for i := 0; i < len(name); i++ {
+		if !isTokenChar(name[i]) {
+			return "", fmt.Errorf("invalid metadata key %q: invalid character %q", key, name[i])
+		}
+	}
+	return name, nil
+}
@@ -0,0 +1,167 @@
+package gstorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// WithMetadataServer is an option that configures the URLSigner to sign on
+// behalf of the default service account of the Google Compute Engine (or
+// GKE, Cloud Run, etc) instance, using the metadata server for the service
+// account's email and access tokens, and the IAM Credentials API's signBlob
+// method for signing.
+//
+// The instance's service account must have the iam.serviceAccounts.signBlob
+// permission on itself (eg, the Service Account Token Creator role).
+func WithMetadataServer(ctx context.Context) Option {
+	return func(u *URLSigner) error {
+		m := newMetadataClient(u.client())
+		if !m.available(ctx) {
+			return errors.New("metadata server is not available")
+		}
+		return u.withMetadata(ctx, m)
+	}
+}
+
+// withMetadataFallback is an option that configures the URLSigner as with
+// WithMetadataServer, when the URLSigner does not have a private key, signer,
+// or backend, and the metadata server is available.
+func withMetadataFallback(ctx context.Context) Option {
+	return func(u *URLSigner) error {
+		if u.PrivateKey != nil || u.Signer != nil || u.Backend != nil {
+			return nil
+		}
+		if m := newMetadataClient(u.client()); m.available(ctx) {
+			return u.withMetadata(ctx, m)
+		}
+		return nil
+	}
+}
+
+// dmiProductName is the path of the system's DMI product name, which is
+// "Google" or "Google Compute Engine" on Google Compute Engine instances
+// (including GKE nodes).
+var dmiProductName = "/sys/class/dmi/id/product_name"
+
+// onGCE returns true when the GCE_METADATA_HOST environment variable is set,
+// or the system's DMI product name indicates a Google Compute Engine
+// instance. This does not make any network requests, and is used to avoid
+// probing for the metadata server when not running on Google Cloud.
+func onGCE() bool {
+	if os.Getenv("GCE_METADATA_HOST") != "" {
+		return true
+	}
+	buf, err := ioutil.ReadFile(dmiProductName)
+	if err != nil {
+		return false
+	}
+	switch strings.TrimSpace(string(buf)) {
+	case "Google", "Google Compute Engine":
+		return true
+	}
+	return false
+}
+
+// withMetadata configures the URLSigner to sign on behalf of the metadata
+// server's default service account.
+func (u *URLSigner) withMetadata(ctx context.Context, m *metadataClient) error {
+	email, err := m.email(ctx)
+	if err != nil {
+		return err
+	}
+	u.ClientEmail, u.Backend = email, &IAMBackend{
+		ServiceAccount: email,
+		TokenSource:    m,
+		Client:         u.Client,
+	}
+	return nil
+}
+
+// metadataClient is a client for the Google Compute Engine metadata server.
+type metadataClient struct {
+	client *http.Client
+	host   string
+	tokens tokenCache
+}
+
+// newMetadataClient creates a metadata server client. The metadata server
+// host can be overridden with the GCE_METADATA_HOST environment variable.
+func newMetadataClient(client *http.Client) *metadataClient {
+	host := os.Getenv("GCE_METADATA_HOST")
+	if host == "" {
+		host = "169.254.169.254"
+	}
+	return &metadataClient{
+		client: client,
+		host:   host,
+	}
+}
+
+// get retrieves the metadata path.
+func (m *metadataClient) get(ctx context.Context, path string) (string, error) {
+	req, err := http.NewRequest("GET", "http://"+m.host+"/computeMetadata/v1/"+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	res, err := m.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer drain(res)
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("could not retrieve metadata %s: %s", path, res.Status)
+	}
+	buf, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(buf)), nil
+}
+
+// available returns true when the metadata server is available.
+func (m *metadataClient) available(ctx context.Context) bool {
+	if os.Getenv("GCE_METADATA_HOST") != "" {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	req, err := http.NewRequest("GET", "http://"+m.host, nil)
+	if err != nil {
+		return false
+	}
+	res, err := m.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return false
+	}
+	defer drain(res)
+	return res.Header.Get("Metadata-Flavor") == "Google"
+}
+
+// email retrieves the default service account's email.
+func (m *metadataClient) email(ctx context.Context) (string, error) {
+	return m.get(ctx, "instance/service-accounts/default/email")
+}
+
+// AccessToken satisfies the TokenSource interface, retrieving the default
+// service account's access token.
+func (m *metadataClient) AccessToken(ctx context.Context) (string, error) {
+	return m.tokens.get(ctx, func(ctx context.Context) (string, time.Time, error) {
+		req, err := http.NewRequest("GET", "http://"+m.host+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		req.Header.Set("Metadata-Flavor", "Google")
+		var res tokenResponse
+		if err := doJSON(m.client, req.WithContext(ctx), &res); err != nil {
+			return "", time.Time{}, err
+		}
+		return res.AccessToken, time.Now().Add(time.Duration(res.ExpiresIn) * time.Second), nil
+	})
+}
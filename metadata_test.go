@@ -0,0 +1,125 @@
+package gstorage
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newTestMetadataServer starts a fake metadata server, setting
+// GCE_METADATA_HOST for the duration of the test.
+func newTestMetadataServer(t *testing.T, email string) *int32 {
+	t.Helper()
+	var requests int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if req.Header.Get("Metadata-Flavor") != "Google" {
+			http.Error(w, "missing Metadata-Flavor", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Metadata-Flavor", "Google")
+		switch req.URL.Path {
+		case "/computeMetadata/v1/instance/service-accounts/default/email":
+			_, _ = w.Write([]byte(email))
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	t.Cleanup(s.Close)
+	setenv(t, map[string]string{"GCE_METADATA_HOST": strings.TrimPrefix(s.URL, "http://")})
+	return &requests
+}
+
+func TestNewURLSignerMetadataServer(t *testing.T) {
+	const email = "default@example.iam.gserviceaccount.com"
+	requests := newTestMetadataServer(t, email)
+	u, err := NewURLSigner()
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if _, ok := u.Backend.(*IAMBackend); !ok || u.ClientEmail != email {
+		t.Errorf("expected metadata server signer, got: %T %q", u.Backend, u.ClientEmail)
+	}
+	// not probed when a key is provided
+	atomic.StoreInt32(requests, 0)
+	if _, err := NewURLSigner(WithGoogleCredentialsJSON(context.Background(), testCredentialsJSON(t))); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if n := atomic.LoadInt32(requests); n != 0 {
+		t.Errorf("expected no metadata server requests, got: %d", n)
+	}
+}
+
+func TestOnGCE(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gstorage")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	prev := dmiProductName
+	defer func() { dmiProductName = prev }()
+	tests := []struct {
+		host    string
+		product string
+		exp     bool
+	}{
+		{"", "", false},
+		{"", "Google Compute Engine\n", true},
+		{"", "Google\n", true},
+		{"", "VirtualBox\n", false},
+		{"", "Googles", false},
+		{"metadata.test", "", true},
+	}
+	for i, test := range tests {
+		setenv(t, map[string]string{"GCE_METADATA_HOST": test.host})
+		dmiProductName = filepath.Join(dir, "missing")
+		if test.product != "" {
+			dmiProductName = filepath.Join(dir, "product_name")
+			if err := ioutil.WriteFile(dmiProductName, []byte(test.product), 0600); err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+		}
+		if b := onGCE(); b != test.exp {
+			t.Errorf("test %d expected %t, got: %t", i, test.exp, b)
+		}
+	}
+	// off gce, construction does not probe the metadata server
+	setenv(t, map[string]string{"GCE_METADATA_HOST": ""})
+	dmiProductName = filepath.Join(dir, "missing")
+	if _, err := NewURLSigner(); err != ErrMissingPrivateKey {
+		t.Errorf("expected ErrMissingPrivateKey, got: %v", err)
+	}
+}
+
+func TestWithMetadataServer(t *testing.T) {
+	const email = "default@example.iam.gserviceaccount.com"
+	newTestMetadataServer(t, email)
+	u, err := NewURLSigner(WithMetadataServer(context.Background()))
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if u.ClientEmail != email {
+		t.Errorf("expected client email %q, got: %q", email, u.ClientEmail)
+	}
+	b, ok := u.Backend.(*IAMBackend)
+	if !ok {
+		t.Fatalf("expected *IAMBackend, got: %T", u.Backend)
+	}
+	if b.ServiceAccount != email {
+		t.Errorf("expected service account %q, got: %q", email, b.ServiceAccount)
+	}
+	// signer configs without a key source fall back to the metadata server
+	s, err := SignerConfig{}.Build()
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if s.Signer.ClientEmail != email {
+		t.Errorf("expected client email %q, got: %q", email, s.Signer.ClientEmail)
+	}
+}
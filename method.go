@@ -0,0 +1,35 @@
+package gstorage
+
+import (
+	"fmt"
+)
+
+// Method is a HTTP method supported by Google Cloud Storage signed URLs.
+type Method string
+
+// Methods.
+const (
+	MethodGet     Method = "GET"
+	MethodHead    Method = "HEAD"
+	MethodPut     Method = "PUT"
+	MethodPost    Method = "POST"
+	MethodDelete  Method = "DELETE"
+	MethodOptions Method = "OPTIONS"
+)
+
+// Validate validates the method is supported, rejecting empty, lowercased,
+// padded (eg, "get "), and unsupported methods.
+func (m Method) Validate() error {
+	switch m {
+	case "":
+		return &wrappedError{"missing method", ErrInvalidMethod}
+	case MethodGet, MethodHead, MethodPut, MethodPost, MethodDelete, MethodOptions:
+		return nil
+	}
+	return &wrappedError{fmt.Sprintf("invalid method %q", string(m)), ErrInvalidMethod}
+}
+
+// isMethod returns true when s is a supported HTTP method.
+func isMethod(s string) bool {
+	return Method(s).Validate() == nil
+}
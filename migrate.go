@@ -0,0 +1,156 @@
+package gstorage
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migration is the result of migrating a V2 signed URL to a V4 signed URL.
+type Migration struct {
+	// Method is the HTTP method of the URLs.
+	Method string `json:"method"`
+
+	// V2URL is the original V2 signed URL.
+	V2URL string `json:"v2_url"`
+
+	// V4URL is the V4 signed URL.
+	V4URL string `json:"v4_url,omitempty"`
+
+	// Bucket is the storage bucket.
+	Bucket string `json:"bucket,omitempty"`
+
+	// Object is the object path.
+	Object string `json:"object,omitempty"`
+
+	// Expiration is the expiration of the V2 signed URL.
+	Expiration time.Time `json:"expiration"`
+
+	// Truncated indicates the V4 signed URL expires before the V2 signed
+	// URL, as V4 signatures cannot have an expiration more than 7 days in
+	// the future.
+	Truncated bool `json:"truncated,omitempty"`
+
+	// Error is the migration error, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// MigrateURL re-signs the object of a previously issued V2 signed URL as a V4
+// signed URL for the method, expiring at the same time as the V2 signed URL
+// (or 7 days from now, whichever is earlier). As V2 signed URLs do not
+// contain the method, it must be supplied.
+//
+// Path style, virtual hosted style, and bucket bound hostname URLs are
+// supported, and the V4 signed URL retains the original URL's style and
+// subresource. The signing params' content type, md5 hash, and headers are
+// not recoverable from V2 signed URLs, so URLs that were signed with them
+// cannot be migrated.
+func (u *URLSigner) MigrateURL(ctx context.Context, method, v2URL string) (*Migration, error) {
+	m := &Migration{
+		Method: method,
+		V2URL:  v2URL,
+	}
+	z, err := url.Parse(v2URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %v", err)
+	}
+	q := z.Query()
+	if q.Get("GoogleAccessId") == "" || q.Get("Signature") == "" {
+		return nil, errors.New("not a v2 signed url")
+	}
+	expires, err := strconv.ParseInt(q.Get("Expires"), 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid expires")
+	}
+	m.Expiration = time.Unix(expires, 0)
+	// determine bucket and object from url style
+	s := *u
+	s.scheme, s.style = SigningSchemeV4, PathStyle
+	p := &SigningParams{
+		Method:     method,
+		Expiration: m.Expiration,
+	}
+	host := strings.TrimPrefix(DefaultBaseURL, "https://")
+	object := strings.TrimPrefix(z.Path, "/")
+	switch {
+	case z.Host == host, "https://"+z.Host == RestrictedBaseURL, "https://"+z.Host == PrivateBaseURL:
+		i := strings.IndexByte(object, '/')
+		if i == -1 {
+			return nil, errors.New("missing object")
+		}
+		p.Bucket, p.Object = object[:i], object[i+1:]
+		p.BaseURL = &url.URL{Scheme: z.Scheme, Host: z.Host}
+	case strings.HasSuffix(z.Host, "."+host):
+		p.Bucket, p.Object = strings.TrimSuffix(z.Host, "."+host), object
+		p.BaseURL = &url.URL{Scheme: z.Scheme, Host: host}
+		s.style = VirtualHostedStyle
+	default:
+		p.Bucket, p.Object = z.Host, object
+		p.BucketBoundHostname = z.Scheme + "://" + z.Host
+	}
+	m.Bucket, m.Object = p.Bucket, p.Object
+	// retain subresource
+	for _, k := range []string{"GoogleAccessId", "Expires", "Signature"} {
+		q.Del(k)
+	}
+	p.Subresource = canonicalQuery(q)
+	// clamp expiration
+	now := u.now()
+	if !m.Expiration.After(now) {
+		return nil, &wrappedError{"url has expired", ErrExpired}
+	}
+	if max := now.Add(v4MaxExpiration); m.Expiration.After(max) {
+		p.Expiration, m.Truncated = max, true
+	}
+	if m.V4URL, err = s.makeV4(ctx, p, now); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// MigrateURLs reads V2 signed URLs from r, migrating each as with MigrateURL
+// and returning the results. Errors migrating individual URLs are reported
+// in the results' Error field.
+//
+// Each line of r may be a manifest entry, consisting of a URL optionally
+// preceded by a method (eg, PUT https://...), or a log line, in which case
+// the first field that is a V2 signed URL is used, along with the last
+// method preceding it (if any). When a line has no method, then method is
+// used instead. Lines without a V2 signed URL are skipped.
+func (u *URLSigner) MigrateURLs(ctx context.Context, r io.Reader, method string) ([]Migration, error) {
+	var res []Migration
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		meth, urlstr := method, ""
+		for _, f := range strings.Fields(s.Text()) {
+			f = strings.Trim(f, `"'`)
+			if isMethod(f) {
+				meth = f
+				continue
+			}
+			if strings.Contains(f, "://") && strings.Contains(f, "GoogleAccessId=") {
+				urlstr = f
+				break
+			}
+		}
+		if urlstr == "" {
+			continue
+		}
+		m, err := u.MigrateURL(ctx, meth, urlstr)
+		if err != nil {
+			m = &Migration{Method: meth, V2URL: urlstr, Error: err.Error()}
+		}
+		res = append(res, *m)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
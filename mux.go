@@ -0,0 +1,210 @@
+package gstorage
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SignerMuxConfig is the configuration for a SignerMux.
+type SignerMuxConfig struct {
+	// Routes are the bucket routes.
+	Routes []SignerRoute `json:"routes"`
+}
+
+// SignerRoute is a bucket route for a SignerMux.
+type SignerRoute struct {
+	// Bucket is the bucket name, or a bucket name prefix when ending with *
+	// (eg, tenant-*).
+	Bucket string `json:"bucket"`
+
+	// CredentialsFile is the path to the Google Service Account credentials
+	// used for signing URLs for the bucket.
+	CredentialsFile string `json:"credentials_file"`
+}
+
+// SignerMux routes signing requests to a URLSigner by bucket name, allowing a
+// multi-tenant service to sign URLs using a different service account per
+// bucket.
+//
+// Buckets are matched exactly first, and then by the longest matching prefix
+// pattern (ie, a pattern ending with *). A pattern of * matches all buckets.
+type SignerMux struct {
+	mu       sync.RWMutex
+	exact    map[string]*URLSigner
+	patterns []string
+	prefixes map[string]*URLSigner
+}
+
+// NewSignerMux creates a new signer mux, loading the credentials for each of
+// the config's routes. The opts are applied to each created URLSigner.
+func NewSignerMux(config SignerMuxConfig, opts ...Option) (*SignerMux, error) {
+	m := new(SignerMux)
+	for _, r := range config.Routes {
+		u, err := NewURLSigner(append([]Option{WithCredentialsFile(r.CredentialsFile)}, opts...)...)
+		if err != nil {
+			return nil, fmt.Errorf("bucket %s: %v", r.Bucket, err)
+		}
+		if err := m.Handle(r.Bucket, u); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Handle registers the URLSigner for the bucket pattern.
+func (m *SignerMux) Handle(pattern string, u *URLSigner) error {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" {
+		return fmt.Errorf("invalid bucket pattern %q", pattern)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !strings.HasSuffix(pattern, "*") {
+		if m.exact == nil {
+			m.exact = make(map[string]*URLSigner)
+		}
+		if _, ok := m.exact[pattern]; ok {
+			return fmt.Errorf("bucket pattern %q already registered", pattern)
+		}
+		m.exact[pattern] = u
+		return nil
+	}
+	prefix := strings.TrimSuffix(pattern, "*")
+	if m.prefixes == nil {
+		m.prefixes = make(map[string]*URLSigner)
+	}
+	if _, ok := m.prefixes[prefix]; ok {
+		return fmt.Errorf("bucket pattern %q already registered", pattern)
+	}
+	m.prefixes[prefix] = u
+	// keep patterns ordered longest first
+	i := 0
+	for i < len(m.patterns) && len(m.patterns[i]) >= len(prefix) {
+		i++
+	}
+	m.patterns = append(m.patterns, "")
+	copy(m.patterns[i+1:], m.patterns[i:])
+	m.patterns[i] = prefix
+	return nil
+}
+
+// Signer returns the URLSigner for the bucket.
+func (m *SignerMux) Signer(bucket string) (*URLSigner, error) {
+	bucket = strings.Trim(bucket, "/")
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if u, ok := m.exact[bucket]; ok {
+		return u, nil
+	}
+	for _, prefix := range m.patterns {
+		if strings.HasPrefix(bucket, prefix) {
+			return m.prefixes[prefix], nil
+		}
+	}
+	return nil, fmt.Errorf("no signer for bucket %s", bucket)
+}
+
+// Make makes a URL for the specified signing params using the URLSigner for
+// the params' bucket.
+func (m *SignerMux) Make(p *SigningParams, d time.Duration) (string, error) {
+	u, err := m.Signer(p.Bucket)
+	if err != nil {
+		return "", err
+	}
+	return u.Make(p, d)
+}
+
+// MakeURL creates a signed URL for the method using the URLSigner for the
+// bucket.
+func (m *SignerMux) MakeURL(method, bucket, path string, d time.Duration, headers map[string]string) (string, error) {
+	u, err := m.Signer(bucket)
+	if err != nil {
+		return "", err
+	}
+	return u.MakeURL(method, bucket, path, d, headers)
+}
+
+// DownloadPath generates a signed path for downloading an object using the
+// URLSigner for the bucket.
+func (m *SignerMux) DownloadPath(bucket, path string) (string, error) {
+	u, err := m.Signer(bucket)
+	if err != nil {
+		return "", err
+	}
+	return u.DownloadPath(bucket, path)
+}
+
+// DownloadPathAs generates a signed path for downloading an object as an
+// attachment with the filename using the URLSigner for the bucket. See
+// URLSigner.DownloadPathAs.
+func (m *SignerMux) DownloadPathAs(bucket, path, filename, contentType string) (string, error) {
+	u, err := m.Signer(bucket)
+	if err != nil {
+		return "", err
+	}
+	return u.DownloadPathAs(bucket, path, filename, contentType)
+}
+
+// HeadPath generates a signed path for retrieving an object's metadata using
+// the URLSigner for the bucket.
+func (m *SignerMux) HeadPath(bucket, path string) (string, error) {
+	u, err := m.Signer(bucket)
+	if err != nil {
+		return "", err
+	}
+	return u.HeadPath(bucket, path)
+}
+
+// OptionsPath generates a signed path for CORS preflight requests for an
+// object using the URLSigner for the bucket.
+func (m *SignerMux) OptionsPath(bucket, path string) (string, error) {
+	u, err := m.Signer(bucket)
+	if err != nil {
+		return "", err
+	}
+	return u.OptionsPath(bucket, path)
+}
+
+// UploadPath generates a signed path for uploading an object using the
+// URLSigner for the bucket.
+func (m *SignerMux) UploadPath(bucket, path string) (string, error) {
+	u, err := m.Signer(bucket)
+	if err != nil {
+		return "", err
+	}
+	return u.UploadPath(bucket, path)
+}
+
+// UploadPathFor generates a signed URL for uploading the content of r to the
+// object using the URLSigner for the bucket. See URLSigner.UploadPathFor.
+func (m *SignerMux) UploadPathFor(bucket, path string, r io.Reader) (*SignedURL, error) {
+	u, err := m.Signer(bucket)
+	if err != nil {
+		return nil, err
+	}
+	return u.UploadPathFor(bucket, path, r)
+}
+
+// DeletePath generates a signed path for deleting an object using the
+// URLSigner for the bucket.
+func (m *SignerMux) DeletePath(bucket, path string) (string, error) {
+	u, err := m.Signer(bucket)
+	if err != nil {
+		return "", err
+	}
+	return u.DeletePath(bucket, path)
+}
+
+// DeleteGenerationPath generates a signed path for deleting the specified
+// generation of an object using the URLSigner for the bucket. See
+// URLSigner.DeleteGenerationPath.
+func (m *SignerMux) DeleteGenerationPath(bucket, path string, generation int64) (string, error) {
+	u, err := m.Signer(bucket)
+	if err != nil {
+		return "", err
+	}
+	return u.DeleteGenerationPath(bucket, path, generation)
+}
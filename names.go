@@ -0,0 +1,186 @@
+package gstorage
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// NameValidator is the interface for object name validators, invoked before
+// signing uploads (PUT and POST requests).
+type NameValidator interface {
+	// ValidateName returns an error when the object name is not valid for the
+	// bucket.
+	ValidateName(bucket, object string) error
+}
+
+// NameValidatorFunc wraps a func as a NameValidator.
+type NameValidatorFunc func(bucket, object string) error
+
+// ValidateName satisfies the NameValidator interface.
+func (f NameValidatorFunc) ValidateName(bucket, object string) error {
+	return f(bucket, object)
+}
+
+// NameRegexp returns a name validator requiring object names to match the
+// regexp.
+func NameRegexp(re *regexp.Regexp) NameValidator {
+	return NameValidatorFunc(func(_, object string) error {
+		if !re.MatchString(object) {
+			return fmt.Errorf("object name does not match %s", re)
+		}
+		return nil
+	})
+}
+
+// nameTemplatePatterns are the name template placeholder patterns.
+var nameTemplatePatterns = map[string]string{
+	"uuid": `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+	"date": `[0-9]{4}-[0-9]{2}-[0-9]{2}`,
+	"int":  `[0-9]+`,
+}
+
+// NameTemplate returns a name validator requiring object names to match the
+// template, such as uploads/{uuid}/{filename}.
+//
+// Placeholders match a single, non-empty path segment, except for {uuid},
+// {date}, and {int} which match a UUID, a YYYY-MM-DD date, and a decimal
+// integer, respectively.
+func NameTemplate(tmpl string) (NameValidator, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	s := strings.TrimPrefix(tmpl, "/")
+	for s != "" {
+		i := strings.IndexByte(s, '{')
+		if i == -1 {
+			sb.WriteString(regexp.QuoteMeta(s))
+			break
+		}
+		sb.WriteString(regexp.QuoteMeta(s[:i]))
+		j := strings.IndexByte(s[i:], '}')
+		if j == -1 {
+			return nil, fmt.Errorf("name template %q has unterminated placeholder", tmpl)
+		}
+		name := s[i+1 : i+j]
+		if name == "" || strings.ContainsAny(name, "{/") {
+			return nil, fmt.Errorf("name template %q has invalid placeholder %q", tmpl, name)
+		}
+		if pat, ok := nameTemplatePatterns[name]; ok {
+			sb.WriteString(pat)
+		} else {
+			sb.WriteString(`[^/]+`)
+		}
+		s = s[i+j+1:]
+	}
+	sb.WriteString("$")
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return nil, fmt.Errorf("name template %q: %v", tmpl, err)
+	}
+	return NameValidatorFunc(func(_, object string) error {
+		if !re.MatchString(strings.TrimPrefix(object, "/")) {
+			return fmt.Errorf("object name does not match template %s", tmpl)
+		}
+		return nil
+	}), nil
+}
+
+// checkName checks the object name of uploads using the URLSigner's name
+// validators.
+func (u *URLSigner) checkName(p *SigningParams) error {
+	if !strings.EqualFold(p.Method, "PUT") && !strings.EqualFold(p.Method, "POST") {
+		return nil
+	}
+	for _, v := range u.nameValidators {
+		if err := v.ValidateName(p.Bucket, p.Object); err != nil {
+			return &PolicyError{Method: p.Method, Bucket: p.Bucket, Object: p.Object, Reason: err.Error()}
+		}
+	}
+	return nil
+}
+
+// ValidateBucketName validates the bucket name against the Google Cloud
+// Storage bucket naming rules.
+//
+// See: https://cloud.google.com/storage/docs/buckets#naming
+func ValidateBucketName(bucket string) error {
+	if err := validateBucketName(bucket); err != nil {
+		return &wrappedError{fmt.Sprintf("invalid bucket name %q: %v", bucket, err), ErrInvalidBucket}
+	}
+	return nil
+}
+
+// validateBucketName validates the bucket name.
+func validateBucketName(bucket string) error {
+	switch n := len(bucket); {
+	case n < 3:
+		return errors.New("must contain at least 3 characters")
+	case n > 222:
+		return errors.New("must contain at most 222 characters")
+	case n > 63 && !strings.Contains(bucket, "."):
+		return errors.New("must contain at most 63 characters, or 222 characters with dots")
+	}
+	for _, c := range bucket {
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return fmt.Errorf("invalid character %q, must contain only lowercase letters, numbers, dashes, underscores, and dots", c)
+		}
+	}
+	if !isAlnum(bucket[0]) || !isAlnum(bucket[len(bucket)-1]) {
+		return errors.New("must start and end with a letter or number")
+	}
+	for _, s := range strings.Split(bucket, ".") {
+		switch {
+		case s == "":
+			return errors.New("must not contain empty dot-separated components")
+		case len(s) > 63:
+			return errors.New("dot-separated components must contain at most 63 characters")
+		}
+	}
+	switch {
+	case net.ParseIP(bucket) != nil:
+		return errors.New("must not be an IP address")
+	case strings.HasPrefix(bucket, "goog"):
+		return errors.New(`must not start with "goog"`)
+	case strings.Contains(bucket, "google"), strings.Contains(bucket, "g00gle"):
+		return errors.New(`must not contain "google"`)
+	}
+	return nil
+}
+
+// isAlnum returns true when c is a lowercase letter or number.
+func isAlnum(c byte) bool {
+	return 'a' <= c && c <= 'z' || '0' <= c && c <= '9'
+}
+
+// ValidateObjectName validates the object name against the Google Cloud
+// Storage object naming rules.
+//
+// See: https://cloud.google.com/storage/docs/objects#naming
+func ValidateObjectName(object string) error {
+	if err := validateObjectName(object); err != nil {
+		return &wrappedError{fmt.Sprintf("invalid object name %q: %v", object, err), ErrInvalidObject}
+	}
+	return nil
+}
+
+// validateObjectName validates the object name.
+func validateObjectName(object string) error {
+	switch {
+	case object == "":
+		return errors.New("must not be empty")
+	case len(object) > 1024:
+		return errors.New("must contain at most 1024 bytes")
+	case !utf8.ValidString(object):
+		return errors.New("must be valid UTF-8")
+	case strings.ContainsAny(object, "\r\n"):
+		return errors.New("must not contain carriage return or line feed characters")
+	case object == "." || object == "..":
+		return errors.New(`must not be "." or ".."`)
+	case strings.HasPrefix(object, ".well-known/acme-challenge/"):
+		return errors.New(`must not start with ".well-known/acme-challenge/"`)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package gstorage
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateObjectName(t *testing.T) {
+	tests := []struct {
+		object string
+		err    bool
+	}{
+		{"file.txt", false},
+		{"dir/file.txt", false},
+		{"dir/", false},
+		{"with space.txt", false},
+		{"hash#question?percent%.txt", false},
+		{"ünïcödé/文件.txt", false},
+		{".well-known/file.txt", false},
+		{"...", false},
+		{strings.Repeat("a", 1024), false},
+		{"", true},
+		{strings.Repeat("a", 1025), true},
+		{"invalid\xffutf8", true},
+		{"carriage\rreturn", true},
+		{"line\nfeed", true},
+		{".", true},
+		{"..", true},
+		{".well-known/acme-challenge/token", true},
+	}
+	for i, test := range tests {
+		err := ValidateObjectName(test.object)
+		switch {
+		case test.err && err == nil:
+			t.Errorf("test %d expected error for %q", i, test.object)
+		case test.err && !errors.Is(err, ErrInvalidObject):
+			t.Errorf("test %d expected ErrInvalidObject, got: %v", i, err)
+		case !test.err && err != nil:
+			t.Errorf("test %d expected no error, got: %v", i, err)
+		}
+	}
+}
+
+func TestObjectNameEscaping(t *testing.T) {
+	objects := []string{
+		"file.txt",
+		"with space.txt",
+		"hash#fragment.txt",
+		"question?mark.txt",
+		"percent%20encoded.txt",
+		"plus+sign&amp=.txt",
+		"ünïcödé/文件.txt",
+		"dir//double/slash.txt",
+	}
+	tests := []struct {
+		scheme SigningScheme
+		style  URLStyle
+	}{
+		{SigningSchemeV2, PathStyle},
+		{SigningSchemeV2, VirtualHostedStyle},
+		{SigningSchemeV4, PathStyle},
+		{SigningSchemeV4, VirtualHostedStyle},
+	}
+	for i, test := range tests {
+		u := &URLSigner{PrivateKey: loadTestKey(t), ClientEmail: "test@example.com", scheme: test.scheme, style: test.style}
+		for _, object := range objects {
+			urlstr, err := u.DownloadPath("bucket", object)
+			if err != nil {
+				t.Fatalf("test %d expected no error, got: %v", i, err)
+			}
+			v, err := url.Parse(urlstr)
+			if err != nil {
+				t.Fatalf("test %d expected no error, got: %v", i, err)
+			}
+			exp := "/bucket/" + object
+			if test.style == VirtualHostedStyle {
+				exp = "/" + object
+			}
+			if v.Path != exp || v.Fragment != "" {
+				t.Errorf("test %d expected path %q, got: %q (fragment %q)", i, exp, v.Path, v.Fragment)
+			}
+			if test.scheme != SigningSchemeV2 {
+				continue
+			}
+			// signature is for the object
+			q := v.Query()
+			expires, err := strconv.ParseInt(q.Get("Expires"), 10, 64)
+			if err != nil {
+				t.Fatalf("test %d expected no error, got: %v", i, err)
+			}
+			p := &SigningParams{Method: "GET", Bucket: "bucket", Object: object, Expiration: time.Unix(expires, 0)}
+			if err := u.Verify(p, q.Get("Signature")); err != nil {
+				t.Errorf("test %d expected signature for %q to verify, got: %v", i, object, err)
+			}
+		}
+	}
+	// the escaped path is signed
+	p := SigningParams{Method: "GET", Bucket: "bucket", Object: "with space/#?.txt"}
+	if s, exp := p.CanonicalResource(), "/bucket/with%20space/%23%3F.txt"; s != exp {
+		t.Errorf("expected canonical resource %q, got: %q", exp, s)
+	}
+}
@@ -1,10 +1,16 @@
 package gstorage
 
 import (
+	"crypto"
 	"crypto/rsa"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/kenshaw/jwt/gserviceaccount"
 	"github.com/kenshaw/pemutil"
@@ -13,48 +19,446 @@ import (
 // Option represents a URLSigner option.
 type Option func(*URLSigner) error
 
-// GoogleServiceAccountCredentialsJSON is an option that loads Google Service
-// Account credentials from a JSON encoded buf.
+// WithCredentialsJSON is an option that loads Google Service Account
+// credentials from a JSON encoded buf, setting the private key and client
+// email from the credentials' private_key and client_email fields.
 //
 // Google Service Account credentials can be downloaded from the Google Cloud
 // console: https://console.cloud.google.com/iam-admin/serviceaccounts/
-func GoogleServiceAccountCredentialsJSON(buf []byte) Option {
+func WithCredentialsJSON(buf []byte) Option {
 	return func(u *URLSigner) error {
-		// load service account credentials
-		gsa, err := gserviceaccount.FromJSON(buf)
+		key, email, keyID, err := parseCredentialsJSON(buf)
 		if err != nil {
 			return err
 		}
-		// simple check
-		if gsa.ClientEmail == "" || gsa.PrivateKey == "" {
-			return errors.New("google service accoount credentials missing client_email or private_key")
-		}
-		// load key
-		s := pemutil.Store{}
-		if err = s.Decode([]byte(gsa.PrivateKey)); err != nil {
-			return err
-		}
-		// grab privKey
-		var ok bool
-		if u.PrivateKey, ok = s[pemutil.RSAPrivateKey].(*rsa.PrivateKey); !ok {
-			return errors.New("google service account credentials has an invalid private_key")
-		}
-		u.ClientEmail = gsa.ClientEmail
+		u.PrivateKey, u.Signer, u.ClientEmail, u.keyID = key, nil, email, keyID
 		return nil
 	}
 }
 
+// parseCredentialsJSON parses JSON encoded Google Service Account credentials,
+// returning the private key, client email, and private key id.
+func parseCredentialsJSON(buf []byte) (*rsa.PrivateKey, string, string, error) {
+	// load service account credentials
+	gsa, err := gserviceaccount.FromJSON(buf)
+	if err != nil {
+		return nil, "", "", err
+	}
+	// simple check
+	if gsa.ClientEmail == "" || gsa.PrivateKey == "" {
+		return nil, "", "", errors.New("google service account credentials missing client_email or private_key")
+	}
+	// load key
+	s := pemutil.Store{}
+	if err = s.Decode([]byte(gsa.PrivateKey)); err != nil {
+		return nil, "", "", err
+	}
+	// grab privKey
+	key, ok := s[pemutil.RSAPrivateKey].(*rsa.PrivateKey)
+	if !ok {
+		return nil, "", "", errors.New("google service account credentials has an invalid private_key")
+	}
+	return key, gsa.ClientEmail, gsa.PrivateKeyID, nil
+}
+
+// WithCredentialsFile is an option that loads Google Service Account
+// credentials from the specified file.
+//
+// See WithCredentialsJSON.
+func WithCredentialsFile(path string) Option {
+	return func(u *URLSigner) error {
+		buf, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("could not read google service account credentials file: %v", err)
+		}
+		return WithCredentialsJSON(buf)(u)
+	}
+}
+
+// GoogleServiceAccountCredentialsJSON is an option that loads Google Service
+// Account credentials from a JSON encoded buf.
+//
+// Deprecated: use WithCredentialsJSON.
+func GoogleServiceAccountCredentialsJSON(buf []byte) Option {
+	return WithCredentialsJSON(buf)
+}
+
 // GoogleServiceAccountCredentialsFile is an option that loads Google Service
 // Account credentials for from the specified file.
 //
-// Google Service Account credentials can be downloaded from the Google Cloud
-// console: https://console.cloud.google.com/iam-admin/serviceaccounts/
+// Deprecated: use WithCredentialsFile.
 func GoogleServiceAccountCredentialsFile(path string) Option {
+	return WithCredentialsFile(path)
+}
+
+// WithPKCS12 is an option that loads the RSA private key from a PKCS#12
+// (.p12) file, as issued by older versions of the Google Cloud console. If
+// password is empty, then DefaultPKCS12Password will be used instead.
+//
+// PKCS#12 files do not contain the service account's client email, which
+// must be set separately with WithClientEmail.
+func WithPKCS12(path, password string) Option {
 	return func(u *URLSigner) error {
 		buf, err := ioutil.ReadFile(path)
 		if err != nil {
-			return fmt.Errorf("could not read google service account credentials file: %v", err)
+			return fmt.Errorf("could not read pkcs12 file: %v", err)
+		}
+		if password == "" {
+			password = DefaultPKCS12Password
+		}
+		key, err := decodePKCS12(buf, password)
+		if err != nil {
+			return fmt.Errorf("could not decode pkcs12 file: %v", err)
+		}
+		k, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return errors.New("pkcs12 file does not contain a rsa private key")
+		}
+		u.setKey(k)
+		return nil
+	}
+}
+
+// WithPEMPassphrase is an option that loads a PEM encoded private key
+// encrypted with the passphrase. Both PKCS#8 encrypted containers (ENCRYPTED
+// PRIVATE KEY) and legacy OpenSSL encrypted PEM blocks are supported.
+func WithPEMPassphrase(buf, passphrase []byte) Option {
+	return func(u *URLSigner) error {
+		key, err := decodePEMKey(buf, passphrase)
+		if err != nil {
+			return fmt.Errorf("could not decode pem private key: %v", err)
+		}
+		u.setKey(key)
+		return nil
+	}
+}
+
+// WithPrivateKey is an option that loads a PEM or DER encoded private key,
+// automatically detecting PKCS#1, PKCS#8, and EC (SEC 1) encoded keys.
+//
+// RSA keys are set as the URLSigner's PrivateKey, while other keys are set
+// as the URLSigner's Signer. Note that Google Cloud Storage only accepts
+// signatures generated by RSA keys.
+func WithPrivateKey(buf []byte) Option {
+	return func(u *URLSigner) error {
+		key, err := parsePrivateKey(buf)
+		if err != nil {
+			return fmt.Errorf("could not load private key: %v", err)
+		}
+		u.setKey(key)
+		return nil
+	}
+}
+
+// WithMinRSAKeyBits is an option that sets the minimum size of RSA private
+// keys. If not set, then DefaultMinRSAKeyBits will be used instead.
+func WithMinRSAKeyBits(bits int) Option {
+	return func(u *URLSigner) error {
+		if bits <= 0 {
+			return fmt.Errorf("invalid minimum rsa key size %d", bits)
 		}
-		return GoogleServiceAccountCredentialsJSON(buf)(u)
+		u.minKeyBits = bits
+		return nil
+	}
+}
+
+// WithClientEmail is an option that sets the client email for the URLSigner.
+func WithClientEmail(email string) Option {
+	return func(u *URLSigner) error {
+		u.ClientEmail = email
+		return nil
+	}
+}
+
+// WithAccessID is an option that sets the access id used for the
+// GoogleAccessId query parameter of signed URLs, independently of the client
+// email, such as for HMAC access ids or delegated accounts.
+func WithAccessID(accessID string) Option {
+	return func(u *URLSigner) error {
+		u.AccessID = accessID
+		return nil
+	}
+}
+
+// WithBackend is an option that sets the remote signing backend used when no
+// private key is loaded.
+func WithBackend(backend Backend) Option {
+	return func(u *URLSigner) error {
+		u.Backend = backend
+		return nil
+	}
+}
+
+// WithPolicy is an option that restricts the URLSigner to signing requests
+// allowed by the policy. See Scoped.
+func WithPolicy(policy Policy) Option {
+	return func(u *URLSigner) error {
+		u.policies = append(u.policies, policy)
+		return nil
+	}
+}
+
+// WithNameValidator is an option that adds a validator for the object names
+// of uploads (PUT and POST requests). Uploads with invalid object names will
+// fail with a *PolicyError. See NameRegexp and NameTemplate.
+func WithNameValidator(v NameValidator) Option {
+	return func(u *URLSigner) error {
+		u.nameValidators = append(u.nameValidators, v)
+		return nil
+	}
+}
+
+// WithNameNormalizer is an option that sets a func used to normalize object
+// names before signing, such as the NFC normalization of the
+// golang.org/x/text/unicode/norm package:
+//
+//	gstorage.WithNameNormalizer(norm.NFC.String)
+//
+// This ensures URLs made for user supplied names (eg, filenames from macOS,
+// which are NFD normalized) match objects stored with NFC normalized names.
+func WithNameNormalizer(f func(string) string) Option {
+	return func(u *URLSigner) error {
+		u.normalizeName = f
+		return nil
+	}
+}
+
+// WithAllowedContentTypes is an option that restricts the content types the
+// URLSigner will sign for uploads (PUT and POST requests). Types may use a
+// wildcard subtype (eg, image/*). Uploads with any other, or no, content type
+// will fail with a *ContentTypeError.
+func WithAllowedContentTypes(types ...string) Option {
+	return WithPolicy(Policy{ContentTypes: types})
+}
+
+// WithRequiredUploadHeaders is an option that requires the md5 hash and/or
+// content type of signing params to be set for uploads (PUT requests), so
+// that clients must send the Content-MD5 and/or Content-Type headers (see
+// SigningParams.RequiredHeaders). Uploads missing a required value will fail
+// with a *PolicyError.
+func WithRequiredUploadHeaders(hash, contentType bool) Option {
+	return WithPolicy(Policy{RequireHash: hash, RequireContentType: contentType})
+}
+
+// WithSignatureHash is an option that sets the hash used for generating
+// signature digests. Only SHA-256, SHA-384, and SHA-512 are accepted; use
+// WithLegacySHA1 for backends that can only produce SHA-1 digests.
+//
+// Google Cloud Storage V2 and V4 signatures are always RSA-SHA256, so other
+// hashes are only valid with a custom canonicalizer (see WithCanonicalizer)
+// for V2 signed URLs, and otherwise fail validation (see
+// URLSigner.Validate). Remote signing backends that are not a DigestSigner
+// only generate RSA-SHA256 signatures.
+func WithSignatureHash(hash crypto.Hash) Option {
+	return func(u *URLSigner) error {
+		switch hash {
+		case crypto.SHA256, crypto.SHA384, crypto.SHA512:
+		case crypto.SHA1:
+			return errors.New("sha1 signature hash must be enabled with WithLegacySHA1")
+		default:
+			return fmt.Errorf("unsupported signature hash %v", hash)
+		}
+		u.hash = hash
+		return nil
+	}
+}
+
+// WithLegacySHA1 is an option that sets the hash used for generating
+// signature digests to SHA-1.
+//
+// SHA-1 is considered weak, and should only be used for interop with legacy
+// signing backends that do not support SHA-256. As with WithSignatureHash,
+// it requires a custom canonicalizer.
+func WithLegacySHA1() Option {
+	return func(u *URLSigner) error {
+		u.hash = crypto.SHA1
+		return nil
+	}
+}
+
+// WithDefaultBucket is an option that sets the default bucket, used when
+// signing params have no bucket (eg, DownloadPath("", "path/to/object")), for
+// services that only sign URLs for a single bucket.
+func WithDefaultBucket(bucket string) Option {
+	return func(u *URLSigner) error {
+		bucket = strings.Trim(bucket, "/")
+		if err := ValidateBucketName(bucket); err != nil {
+			return err
+		}
+		u.bucket = bucket
+		return nil
+	}
+}
+
+// WithDefaultExpiration is an option that sets the default expiration of URLs
+// made by DownloadPath, DownloadPathAs, HeadPath, OptionsPath, UploadPath,
+// UploadPathFor, DeletePath, and PendingUpload. If not set, then DefaultExpiration will be
+// used instead.
+func WithDefaultExpiration(d time.Duration) Option {
+	return func(u *URLSigner) error {
+		if d <= 0 {
+			return fmt.Errorf("invalid default expiration %v", d)
+		}
+		u.expiration = d
+		return nil
+	}
+}
+
+// WithDeadlineExpiration is an option that derives the expiration of URLs
+// made with MakeContext from the context's deadline, so that URLs made while
+// handling a request do not outlive the request. The requested expiration
+// remains the upper bound, and min is the lower bound, ensuring URLs remain
+// usable when the deadline is imminent (or has passed).
+func WithDeadlineExpiration(min time.Duration) Option {
+	return func(u *URLSigner) error {
+		if min < 0 {
+			return errors.New("invalid minimum expiration")
+		}
+		u.deadlineExpiration, u.minExpiration = true, min
+		return nil
+	}
+}
+
+// WithCDNFallback is an option that sets the Media CDN signer used for making
+// URLs with signing params having NotBefore set.
+func WithCDNFallback(cdn *CDNSigner) Option {
+	return func(u *URLSigner) error {
+		u.cdn = cdn
+		return nil
+	}
+}
+
+// WithRand is an option that sets the random source used by the URLSigner
+// when generating signatures with a local private key, signer, or key backend
+// (such as a KeyRing, or the backends of WithKeyRefresh and WithKeyFileReload),
+// and for retry jitter. If not set, then crypto/rand.Reader will be used
+// instead.
+//
+// The random source must be cryptographically secure, and should only be
+// replaced for deterministic tests, or to use a mandated hardware source.
+func WithRand(r io.Reader) Option {
+	return func(u *URLSigner) error {
+		u.rand = r
+		return nil
+	}
+}
+
+// WithClock is an option that sets the func used for the current time, used
+// for expirations, V4 request timestamps, and expiration checks. If not set,
+// then time.Now will be used instead.
+//
+// The clock should only be replaced for deterministic tests, or for hosts
+// with a known clock skew.
+func WithClock(now func() time.Time) Option {
+	return func(u *URLSigner) error {
+		u.clock = now
+		return nil
+	}
+}
+
+// WithURLStyle is an option that sets the style of generated URLs. V2
+// signatures are unaffected by the URL style, as the canonical resource
+// always includes the bucket, while V4 signatures sign the URL's host and
+// path.
+func WithURLStyle(style URLStyle) Option {
+	return func(u *URLSigner) error {
+		switch style {
+		case PathStyle, VirtualHostedStyle:
+		default:
+			return fmt.Errorf("invalid url style %d", style)
+		}
+		u.style = style
+		return nil
+	}
+}
+
+// WithEmulator is an option that sets the host (and port) of a storage
+// emulator, such as fake-gcs-server, for generated URLs, for use during
+// tests. The host may include a scheme (eg, https://localhost:4443), and
+// when it does not, then plain HTTP is used.
+//
+// Emulators generally only support path style URLs. See WithURLStyle.
+func WithEmulator(host string) Option {
+	return func(u *URLSigner) error {
+		if !strings.Contains(host, "://") {
+			host = "http://" + host
+		}
+		z, err := url.Parse(host)
+		if err != nil || z.Host == "" {
+			return fmt.Errorf("invalid emulator host %q", host)
+		}
+		u.BaseURL = &url.URL{Scheme: z.Scheme, Host: z.Host}
+		return nil
+	}
+}
+
+// WithBaseURL is an option that sets the base URL used for building URLs,
+// such as a private endpoint or proxy. The base URL may include a port and a
+// path prefix, which is prepended to the path of generated URLs.
+func WithBaseURL(baseURL string) Option {
+	return func(u *URLSigner) error {
+		z, err := url.Parse(baseURL)
+		if err != nil || z.Scheme == "" || z.Host == "" {
+			return fmt.Errorf("invalid base url %q", baseURL)
+		}
+		z.RawQuery, z.Fragment = "", ""
+		u.BaseURL = z
+		return nil
+	}
+}
+
+// WithGoogleEndpoint is an option that sets the base URL used for building
+// URLs to a Google Cloud Storage endpoint, such as RestrictedBaseURL or
+// PrivateBaseURL for VPC Service Controls and Private Google Access
+// environments. Only https URLs having the host of DefaultBaseURL,
+// RestrictedBaseURL, or PrivateBaseURL are accepted.
+//
+// V2 signatures do not depend on the host. V4 signatures sign the endpoint's
+// host, so URLs must be used with the same endpoint.
+func WithGoogleEndpoint(baseURL string) Option {
+	return func(u *URLSigner) error {
+		z, err := url.Parse(baseURL)
+		if err != nil {
+			return fmt.Errorf("invalid google endpoint %q", baseURL)
+		}
+		switch {
+		case z.Scheme != "https",
+			z.Path != "" && z.Path != "/",
+			z.User != nil, z.RawQuery != "", z.Fragment != "":
+			return fmt.Errorf("invalid google endpoint %q", baseURL)
+		}
+		switch "https://" + z.Host {
+		case DefaultBaseURL, RestrictedBaseURL, PrivateBaseURL:
+		default:
+			return fmt.Errorf("unknown google endpoint host %q", z.Host)
+		}
+		u.BaseURL = &url.URL{Scheme: z.Scheme, Host: z.Host}
+		return nil
+	}
+}
+
+// WithSigningScheme is an option that sets the signing scheme of generated
+// URLs. If not set, then V2 signatures are generated.
+//
+// V4 signatures are always generated with RSA-SHA256, and cannot have an
+// expiration more than 7 days in the future.
+func WithSigningScheme(scheme SigningScheme) Option {
+	return func(u *URLSigner) error {
+		switch scheme {
+		case SigningSchemeDefault, SigningSchemeV2, SigningSchemeV4:
+		default:
+			return fmt.Errorf("invalid signing scheme %d", scheme)
+		}
+		u.scheme = scheme
+		return nil
+	}
+}
+
+// WithHTTPClient is an option that sets the HTTP client used for requests
+// made by the URLSigner.
+func WithHTTPClient(client *http.Client) Option {
+	return func(u *URLSigner) error {
+		u.Client = client
+		return nil
 	}
 }
@@ -0,0 +1,227 @@
+package gstorage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ParamsOption represents a signing params option.
+type ParamsOption func(*SigningParams)
+
+// NewSigningParams creates signing params for the bucket and object, applying
+// the options. The method defaults to GET, and the expiration is determined
+// when signing.
+func NewSigningParams(bucket, object string, opts ...ParamsOption) *SigningParams {
+	p := &SigningParams{
+		Method: "GET",
+		Bucket: bucket,
+		Object: object,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// SigningParamsFromRequest creates signing params for the bucket from an
+// incoming request, such as for proxy services re-signing client requests
+// for Google Cloud Storage. The method, content type, md5 hash (from the
+// Content-MD5 header), and x-goog-* headers are taken from the request,
+// except for reserved headers (eg, X-Goog-Date) and the customer-supplied
+// encryption key headers, which are not signed. The object is the request's
+// URL path, without the leading slash, and without the leading bucket segment
+// for path-style requests (ie, /bucket/object). The request's query is not
+// used.
+func SigningParamsFromRequest(req *http.Request, bucket string) *SigningParams {
+	object := strings.TrimPrefix(req.URL.Path, "/")
+	if !strings.HasPrefix(strings.ToLower(req.Host), bucket+".") {
+		switch {
+		case object == bucket:
+			object = ""
+		case strings.HasPrefix(object, bucket+"/"):
+			object = object[len(bucket)+1:]
+		}
+	}
+	p := &SigningParams{
+		Method:      req.Method,
+		Hash:        req.Header.Get("Content-MD5"),
+		ContentType: req.Header.Get("Content-Type"),
+		Bucket:      bucket,
+		Object:      object,
+	}
+	for k, v := range req.Header {
+		name := strings.ToLower(k)
+		if _, ok := reservedHeaders[name]; ok || !isExtensionHeader(name) || isEncryptionKeyHeader(name) {
+			continue
+		}
+		if p.Headers == nil {
+			p.Headers = make(http.Header)
+		}
+		p.Headers[k] = append([]string(nil), v...)
+	}
+	return p
+}
+
+// WithMethod is a signing params option that sets the HTTP method.
+func WithMethod(method Method) ParamsOption {
+	return func(p *SigningParams) {
+		p.Method = string(method)
+	}
+}
+
+// WithContentType is a signing params option that sets the content type of
+// an upload.
+func WithContentType(contentType string) ParamsOption {
+	return func(p *SigningParams) {
+		p.ContentType = contentType
+	}
+}
+
+// WithHash is a signing params option that sets the md5 hash of an upload.
+// See HashReader.
+func WithHash(hash string) ParamsOption {
+	return func(p *SigningParams) {
+		p.Hash = hash
+	}
+}
+
+// WithCRC32CHash is a signing params option that sets the crc32c checksum of
+// an upload. See CRC32C.
+func WithCRC32CHash(crc32c string) ParamsOption {
+	return func(p *SigningParams) {
+		p.CRC32C = crc32c
+	}
+}
+
+// WithHeader is a signing params option that adds the values of a header.
+func WithHeader(name string, values ...string) ParamsOption {
+	return func(p *SigningParams) {
+		if p.Headers == nil {
+			p.Headers = make(http.Header)
+		}
+		p.Headers[name] = append(p.Headers[name], values...)
+	}
+}
+
+// WithExpiry is a signing params option that sets the TTL, so that generated
+// signatures are valid for d from the time of signing.
+func WithExpiry(d time.Duration) ParamsOption {
+	return func(p *SigningParams) {
+		p.TTL = d
+	}
+}
+
+// WithSubresource is a signing params option that sets the XML API
+// subresource.
+func WithSubresource(subresource string) ParamsOption {
+	return func(p *SigningParams) {
+		p.Subresource = subresource
+	}
+}
+
+// signingParamsJSON is the JSON representation of signing params.
+type signingParamsJSON struct {
+	BaseURL             string           `json:"base_url,omitempty"`
+	Method              string           `json:"method"`
+	Hash                string           `json:"hash,omitempty"`
+	CRC32C              string           `json:"crc32c,omitempty"`
+	ContentType         string           `json:"content_type,omitempty"`
+	Expiration          *time.Time       `json:"expiration,omitempty"`
+	TTL                 string           `json:"ttl,omitempty"`
+	NotBefore           *time.Time       `json:"not_before,omitempty"`
+	Headers             http.Header      `json:"headers,omitempty"`
+	Bucket              string           `json:"bucket"`
+	Object              string           `json:"object,omitempty"`
+	BucketBoundHostname string           `json:"bucket_bound_hostname,omitempty"`
+	ExtraQuery          url.Values       `json:"extra_query,omitempty"`
+	Response            *ResponseHeaders `json:"response,omitempty"`
+	Subresource         string           `json:"subresource,omitempty"`
+}
+
+// MarshalJSON satisfies the json.Marshaler interface, so that signing params
+// can be queued, cached, or sent to a signing service. The base URL is
+// encoded as a string, times are encoded in RFC 3339 format with nanosecond
+// precision, the TTL is encoded as a duration string (eg, 15m0s), and empty
+// fields are omitted.
+func (p SigningParams) MarshalJSON() ([]byte, error) {
+	v := signingParamsJSON{
+		Method:              p.Method,
+		Hash:                p.Hash,
+		CRC32C:              p.CRC32C,
+		ContentType:         p.ContentType,
+		Headers:             p.Headers,
+		Bucket:              p.Bucket,
+		Object:              p.Object,
+		BucketBoundHostname: p.BucketBoundHostname,
+		ExtraQuery:          p.ExtraQuery,
+		Subresource:         p.Subresource,
+	}
+	if p.BaseURL != nil {
+		v.BaseURL = p.BaseURL.String()
+	}
+	if !p.Expiration.IsZero() {
+		v.Expiration = &p.Expiration
+	}
+	if p.TTL != 0 {
+		v.TTL = p.TTL.String()
+	}
+	if !p.NotBefore.IsZero() {
+		v.NotBefore = &p.NotBefore
+	}
+	if p.Response != (ResponseHeaders{}) {
+		v.Response = &p.Response
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON satisfies the json.Unmarshaler interface. Unknown fields are
+// rejected.
+func (p *SigningParams) UnmarshalJSON(buf []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.DisallowUnknownFields()
+	var v signingParamsJSON
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	*p = SigningParams{
+		Method:              v.Method,
+		Hash:                v.Hash,
+		CRC32C:              v.CRC32C,
+		ContentType:         v.ContentType,
+		Headers:             v.Headers,
+		Bucket:              v.Bucket,
+		Object:              v.Object,
+		BucketBoundHostname: v.BucketBoundHostname,
+		ExtraQuery:          v.ExtraQuery,
+		Subresource:         v.Subresource,
+	}
+	if v.BaseURL != "" {
+		u, err := url.Parse(v.BaseURL)
+		if err != nil {
+			return fmt.Errorf("invalid base url %q: %v", v.BaseURL, err)
+		}
+		p.BaseURL = u
+	}
+	if v.Expiration != nil {
+		p.Expiration = *v.Expiration
+	}
+	if v.TTL != "" {
+		d, err := time.ParseDuration(v.TTL)
+		if err != nil {
+			return fmt.Errorf("invalid ttl %q: %v", v.TTL, err)
+		}
+		p.TTL = d
+	}
+	if v.NotBefore != nil {
+		p.NotBefore = *v.NotBefore
+	}
+	if v.Response != nil {
+		p.Response = *v.Response
+	}
+	return nil
+}
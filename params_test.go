@@ -0,0 +1,190 @@
+package gstorage
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewSigningParams(t *testing.T) {
+	tests := []struct {
+		opts []ParamsOption
+		exp  SigningParams
+	}{
+		{nil, SigningParams{Method: "GET", Bucket: "bucket", Object: "file.txt"}},
+		{
+			[]ParamsOption{
+				WithMethod(MethodPut),
+				WithContentType("text/plain"),
+				WithHash("XUFAKrxLKna5cZ2REBfFkg=="),
+				WithCRC32CHash("mnG7TA=="),
+				WithHeader("x-goog-meta-a", "1"),
+				WithHeader("x-goog-meta-a", "2"),
+				WithExpiry(5 * time.Minute),
+				WithSubresource("tagging"),
+			},
+			SigningParams{
+				Method:      "PUT",
+				Hash:        "XUFAKrxLKna5cZ2REBfFkg==",
+				CRC32C:      "mnG7TA==",
+				ContentType: "text/plain",
+				TTL:         5 * time.Minute,
+				Headers:     http.Header{"x-goog-meta-a": {"1", "2"}},
+				Bucket:      "bucket",
+				Object:      "file.txt",
+				Subresource: "tagging",
+			},
+		},
+	}
+	for i, test := range tests {
+		p := NewSigningParams("bucket", "file.txt", test.opts...)
+		if !reflect.DeepEqual(*p, test.exp) {
+			t.Errorf("test %d expected %+v, got: %+v", i, test.exp, *p)
+		}
+	}
+}
+
+func TestSigningParamsFromRequest(t *testing.T) {
+	tests := []struct {
+		urlstr string
+		exp    string
+	}{
+		{"https://storage.googleapis.com/bucket/dir/file.txt", "dir/file.txt"},
+		{"https://storage.googleapis.com/bucket/bucket/file.txt", "bucket/file.txt"},
+		{"https://storage.googleapis.com/bucket", ""},
+		{"https://storage.googleapis.com/other/file.txt", "other/file.txt"},
+		{"https://bucket.storage.googleapis.com/bucket/file.txt", "bucket/file.txt"},
+		{"https://proxy.example.com/file.txt", "file.txt"},
+	}
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.urlstr, nil)
+		if err != nil {
+			t.Fatalf("test %d expected no error, got: %v", i, err)
+		}
+		if p := SigningParamsFromRequest(req, "bucket"); p.Bucket != "bucket" || p.Object != test.exp {
+			t.Errorf("test %d expected bucket/object bucket/%s, got: %s/%s", i, test.exp, p.Bucket, p.Object)
+		}
+	}
+	// round trip a signed request
+	u := &URLSigner{PrivateKey: loadTestKey(t), ClientEmail: "test@example.com"}
+	p := NewSigningParams("bucket", "dir/file.txt",
+		WithMethod(MethodPut),
+		WithContentType("text/plain"),
+		WithHash("XUFAKrxLKna5cZ2REBfFkg=="),
+		WithHeader("x-goog-meta-a", "1"),
+		WithHeader("X-Goog-Encryption-Algorithm", "AES256"),
+	)
+	urlstr, err := u.Make(p, time.Hour)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	req, err := http.NewRequest("PUT", urlstr, strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	for k, v := range map[string]string{
+		"Content-Type":                 "text/plain",
+		"Content-MD5":                  "XUFAKrxLKna5cZ2REBfFkg==",
+		"X-Goog-Meta-A":                "1",
+		"X-Goog-Encryption-Algorithm":  "AES256",
+		"X-Goog-Encryption-Key":        "a2V5",
+		"X-Goog-Encryption-Key-Sha256": "aGFzaA==",
+		"X-Goog-Date":                  "20200101T000000Z",
+		"Authorization":                "Bearer token",
+		"User-Agent":                   "test",
+	} {
+		req.Header.Set(k, v)
+	}
+	q := SigningParamsFromRequest(req, "bucket")
+	exp := http.Header{"X-Goog-Meta-A": {"1"}, "X-Goog-Encryption-Algorithm": {"AES256"}}
+	if !reflect.DeepEqual(q.Headers, exp) {
+		t.Errorf("expected headers %v, got: %v", exp, q.Headers)
+	}
+	v, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	expires, err := strconv.ParseInt(v.Get("Expires"), 10, 64)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	q.Expiration = time.Unix(expires, 0)
+	if err := u.Verify(q, v.Get("Signature")); err != nil {
+		t.Errorf("expected no error, got: %v", err)
+	}
+}
+
+func TestSigningParamsJSON(t *testing.T) {
+	baseURL, err := url.Parse("https://storage.example.com/prefix")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	tests := []SigningParams{
+		{Method: "GET", Bucket: "bucket"},
+		{
+			BaseURL:     baseURL,
+			Method:      "PUT",
+			Hash:        "XUFAKrxLKna5cZ2REBfFkg==",
+			CRC32C:      "mnG7TA==",
+			ContentType: "text/plain",
+			Expiration:  time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC),
+			TTL:         90 * time.Second,
+			NotBefore:   time.Date(2020, 1, 1, 0, 0, 0, 0, time.FixedZone("", 3600)),
+			Headers:     http.Header{"x-goog-meta-a": {"1", "2"}, "X-Goog-Acl": {"private"}},
+			Bucket:      "bucket",
+			Object:      "dir/file.txt",
+			ExtraQuery:  url.Values{"userProject": {"project"}, "a": {"1", "2"}},
+			Response:    ResponseHeaders{ContentDisposition: "attachment"},
+			Subresource: "tagging",
+		},
+	}
+	for i, test := range tests {
+		buf, err := json.Marshal(test)
+		if err != nil {
+			t.Fatalf("test %d expected no error, got: %v", i, err)
+		}
+		var p SigningParams
+		if err := json.Unmarshal(buf, &p); err != nil {
+			t.Fatalf("test %d expected no error, got: %v", i, err)
+		}
+		if !p.Expiration.Equal(test.Expiration) || !p.NotBefore.Equal(test.NotBefore) {
+			t.Errorf("test %d expected expiration %v and not before %v, got: %v %v", i, test.Expiration, test.NotBefore, p.Expiration, p.NotBefore)
+		}
+		p.Expiration, p.NotBefore = test.Expiration, test.NotBefore
+		if !reflect.DeepEqual(p, test) {
+			t.Errorf("test %d expected %+v, got: %+v", i, test, p)
+		}
+	}
+	// encoding of duration and time fields
+	buf, err := json.Marshal(tests[1])
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	for _, s := range []string{`"ttl":"1m30s"`, `"expiration":"2020-01-02T03:04:05.000000006Z"`} {
+		if !strings.Contains(string(buf), s) {
+			t.Errorf("expected %s in %s", s, buf)
+		}
+	}
+	// invalid
+	for i, s := range []string{
+		`{"method":"GET","bucket":"bucket","unknown":1}`,
+		`{"method":"GET","bucket":"bucket","object":1}`,
+		`{"method":"GET","bucket":"bucket","ttl":"1 minute"}`,
+		`{"method":"GET","bucket":"bucket","ttl":60}`,
+		`{"method":"GET","bucket":"bucket","expiration":"tomorrow"}`,
+		`{"method":"GET","bucket":"bucket","base_url":"://"}`,
+		`{"method":"GET","bucket":"bucket","headers":{"x-goog-meta-a":"1"}}`,
+		`{"method":"GET","bucket":"bucket","response":{"content_type":"text/plain","other":"x"}}`,
+		`["GET"]`,
+	} {
+		var p SigningParams
+		if err := json.Unmarshal([]byte(s), &p); err == nil {
+			t.Errorf("test %d expected error for %s", i, s)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package gstorage
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+// DefaultPKCS12Password is the password used by Google Cloud for PKCS#12
+// (.p12) service account keys.
+const DefaultPKCS12Password = "notasecret"
+
+var (
+	oidDataContentType          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEncryptedDataContentType = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+	oidKeyBag                   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 1}
+	oidPKCS8ShroudedKeyBag      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidPBEWithSHAAnd3KeyTDES    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+	oidSHA1                     = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256                   = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+)
+
+type pfxPdu struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+}
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int `asn1:"optional,default:1"`
+}
+
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type encryptedData struct {
+	Version              int
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           []byte `asn1:"tag:0,optional"`
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue   `asn1:"tag:0,explicit"`
+	Attributes []asn1.RawValue `asn1:"set,optional"`
+}
+
+type pbeParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+// decodePKCS12 decodes the private key contained in a PKCS#12 buf.
+func decodePKCS12(buf []byte, password string) (crypto.PrivateKey, error) {
+	buf, err := berToDER(buf)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pkcs12: %v", err)
+	}
+	var pfx pfxPdu
+	if _, err := asn1.Unmarshal(buf, &pfx); err != nil {
+		return nil, fmt.Errorf("invalid pkcs12: %v", err)
+	}
+	if pfx.Version != 3 {
+		return nil, fmt.Errorf("unsupported pkcs12 version %d", pfx.Version)
+	}
+	if !pfx.AuthSafe.ContentType.Equal(oidDataContentType) {
+		return nil, errors.New("unsupported pkcs12 auth safe content type")
+	}
+	var authSafe []byte
+	if _, err := asn1.Unmarshal(pfx.AuthSafe.Content.Bytes, &authSafe); err != nil {
+		return nil, fmt.Errorf("invalid pkcs12 auth safe: %v", err)
+	}
+	if len(pfx.MacData.Mac.Algorithm.Algorithm) != 0 {
+		if err := pfx.MacData.verify(authSafe, bmpString(password)); err != nil {
+			return nil, err
+		}
+	}
+	var contents []contentInfo
+	if _, err := asn1.Unmarshal(authSafe, &contents); err != nil {
+		return nil, fmt.Errorf("invalid pkcs12 auth safe: %v", err)
+	}
+	// find key bag
+	var lastErr error
+	for _, ci := range contents {
+		var bags []safeBag
+		if bags, err = ci.safeBags([]byte(password)); err != nil {
+			lastErr = err
+			continue
+		}
+		for _, bag := range bags {
+			switch {
+			case bag.ID.Equal(oidKeyBag):
+				return x509.ParsePKCS8PrivateKey(bag.Value.Bytes)
+			case bag.ID.Equal(oidPKCS8ShroudedKeyBag):
+				der, err := decryptPrivateKeyInfo(bag.Value.Bytes, []byte(password))
+				if err != nil {
+					return nil, err
+				}
+				return x509.ParsePKCS8PrivateKey(der)
+			}
+		}
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, errors.New("pkcs12 does not contain a private key")
+}
+
+// verify verifies the pkcs12 mac for buf.
+func (m macData) verify(buf, pass []byte) error {
+	var hash crypto.Hash
+	switch alg := m.Mac.Algorithm.Algorithm; {
+	case alg.Equal(oidSHA1):
+		hash = crypto.SHA1
+	case alg.Equal(oidSHA256):
+		hash = crypto.SHA256
+	default:
+		return fmt.Errorf("unsupported pkcs12 mac algorithm %v", alg)
+	}
+	key := pkcs12KDF(hash, pass, m.MacSalt, m.Iterations, 3, hash.Size())
+	mac := hmac.New(hash.New, key)
+	_, _ = mac.Write(buf)
+	if !hmac.Equal(mac.Sum(nil), m.Mac.Digest) {
+		return errors.New("pkcs12 mac verification failed (incorrect password?)")
+	}
+	return nil
+}
+
+// safeBags returns the safe bags for the content info, decrypting the
+// content if necessary.
+func (ci contentInfo) safeBags(password []byte) ([]safeBag, error) {
+	var buf []byte
+	switch {
+	case ci.ContentType.Equal(oidDataContentType):
+		if _, err := asn1.Unmarshal(ci.Content.Bytes, &buf); err != nil {
+			return nil, fmt.Errorf("invalid pkcs12 data: %v", err)
+		}
+	case ci.ContentType.Equal(oidEncryptedDataContentType):
+		var ed encryptedData
+		if _, err := asn1.Unmarshal(ci.Content.Bytes, &ed); err != nil {
+			return nil, fmt.Errorf("invalid pkcs12 encrypted data: %v", err)
+		}
+		var err error
+		eci := ed.EncryptedContentInfo
+		if buf, err = pbeDecrypt(eci.ContentEncryptionAlgorithm, eci.EncryptedContent, password); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported pkcs12 content type %v", ci.ContentType)
+	}
+	var bags []safeBag
+	if _, err := asn1.Unmarshal(buf, &bags); err != nil {
+		return nil, fmt.Errorf("invalid pkcs12 safe contents: %v", err)
+	}
+	return bags, nil
+}
+
+// pkcs12Decrypt decrypts buf using the PKCS#12 password based encryption
+// algorithm.
+func pkcs12Decrypt(alg pkix.AlgorithmIdentifier, buf, password []byte) ([]byte, error) {
+	var params pbeParams
+	if _, err := asn1.Unmarshal(alg.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("invalid encryption algorithm parameters: %v", err)
+	}
+	pass := bmpString(string(password))
+	key := pkcs12KDF(crypto.SHA1, pass, params.Salt, params.Iterations, 1, 24)
+	iv := pkcs12KDF(crypto.SHA1, pass, params.Salt, params.Iterations, 2, des.BlockSize)
+	block, err := des.NewTripleDESCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cbcDecrypt(block, iv, buf)
+}
+
+// pkcs12KDF derives n bytes of key material with the specified id from the
+// password and salt, as described in RFC 7292, Appendix B.2.
+func pkcs12KDF(hash crypto.Hash, pass, salt []byte, iterations int, id byte, n int) []byte {
+	v := hash.New().BlockSize()
+	fill := func(b []byte) []byte {
+		if len(b) == 0 {
+			return nil
+		}
+		out := make([]byte, v*((len(b)+v-1)/v))
+		for i := range out {
+			out[i] = b[i%len(b)]
+		}
+		return out
+	}
+	d := bytes.Repeat([]byte{id}, v)
+	i := append(fill(salt), fill(pass)...)
+	var out []byte
+	for {
+		h := hash.New()
+		_, _ = h.Write(d)
+		_, _ = h.Write(i)
+		a := h.Sum(nil)
+		for j := 1; j < iterations; j++ {
+			h.Reset()
+			_, _ = h.Write(a)
+			a = h.Sum(a[:0])
+		}
+		if out = append(out, a...); len(out) >= n {
+			return out[:n]
+		}
+		// i_j = (i_j + b + 1) mod 2^(v*8)
+		b := make([]byte, v)
+		for k := range b {
+			b[k] = a[k%len(a)]
+		}
+		for j := 0; j < len(i); j += v {
+			carry := 1
+			for k := v - 1; k >= 0; k-- {
+				x := int(i[j+k]) + int(b[k]) + carry
+				i[j+k], carry = byte(x), x>>8
+			}
+		}
+	}
+}
+
+// bmpString returns the null terminated BMPString (UTF-16BE) encoding of s.
+func bmpString(s string) []byte {
+	var buf []byte
+	for _, r := range utf16.Encode([]rune(s)) {
+		buf = append(buf, byte(r>>8), byte(r))
+	}
+	return append(buf, 0, 0)
+}
+
+// berToDER converts BER encoded buf to DER by rewriting indefinite length
+// encodings.
+func berToDER(buf []byte) ([]byte, error) {
+	out, rest, err := berConvert(buf)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("trailing data")
+	}
+	return out, nil
+}
+
+// berConvert converts the first BER encoded value in buf to DER, returning
+// the remaining data.
+func berConvert(buf []byte) ([]byte, []byte, error) {
+	// tag
+	if len(buf) < 2 {
+		return nil, nil, errors.New("truncated data")
+	}
+	i := 1
+	if buf[0]&0x1f == 0x1f {
+		for i < len(buf) && buf[i]&0x80 != 0 {
+			i++
+		}
+		i++
+	}
+	if i >= len(buf) {
+		return nil, nil, errors.New("truncated tag")
+	}
+	tag, constructed := buf[:i], buf[0]&0x20 != 0
+	// length
+	l := buf[i]
+	i++
+	var content, rest []byte
+	switch {
+	case l == 0x80:
+		if !constructed {
+			return nil, nil, errors.New("indefinite length primitive value")
+		}
+		for rest = buf[i:]; ; {
+			if len(rest) < 2 {
+				return nil, nil, errors.New("missing end of contents")
+			}
+			if rest[0] == 0 && rest[1] == 0 {
+				rest = rest[2:]
+				break
+			}
+			var child []byte
+			var err error
+			if child, rest, err = berConvert(rest); err != nil {
+				return nil, nil, err
+			}
+			content = append(content, child...)
+		}
+	default:
+		length := int(l)
+		if l&0x80 != 0 {
+			n := int(l & 0x7f)
+			if n > 4 || i+n > len(buf) {
+				return nil, nil, errors.New("invalid length")
+			}
+			length = 0
+			for _, b := range buf[i : i+n] {
+				length = length<<8 | int(b)
+			}
+			i += n
+		}
+		if length < 0 || length > len(buf)-i {
+			return nil, nil, errors.New("truncated value")
+		}
+		content, rest = buf[i:i+length], buf[i+length:]
+		if constructed {
+			var children []byte
+			for body := content; len(body) != 0; {
+				var child []byte
+				var err error
+				if child, body, err = berConvert(body); err != nil {
+					return nil, nil, err
+				}
+				children = append(children, child...)
+			}
+			content = children
+		}
+	}
+	out := append([]byte{}, tag...)
+	out = append(out, derLength(len(content))...)
+	return append(out, content...), rest, nil
+}
+
+// derLength returns the DER encoding of the length n.
+func derLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var buf []byte
+	for ; n != 0; n >>= 8 {
+		buf = append([]byte{byte(n)}, buf...)
+	}
+	return append([]byte{0x80 | byte(len(buf))}, buf...)
+}
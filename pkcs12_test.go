@@ -0,0 +1,127 @@
+package gstorage
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"testing"
+)
+
+// The .p12 files in testdata/ were generated with OpenSSL 3.0 from
+// testdata/key.pem:
+//
+//   openssl pkcs12 -export -legacy -passout pass:notasecret -out legacy.p12
+//   openssl pkcs12 -export -legacy -macalg sha256 -passout pass:notasecret -out sha256.p12
+//   openssl pkcs12 -export -passout pass:notasecret -out modern.p12
+
+// loadTestKey loads the unencrypted private key in testdata/key.pem.
+func loadTestKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	buf, err := ioutil.ReadFile("testdata/key.pem")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	block, _ := pem.Decode(buf)
+	if block == nil {
+		t.Fatal("expected pem block in testdata/key.pem")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	return key.(*rsa.PrivateKey)
+}
+
+func TestDecodePKCS12(t *testing.T) {
+	want := loadTestKey(t)
+	tests := []string{
+		"testdata/legacy.p12",
+		"testdata/sha256.p12",
+		"testdata/modern.p12",
+	}
+	for i, test := range tests {
+		buf, err := ioutil.ReadFile(test)
+		if err != nil {
+			t.Fatalf("test %d expected no error, got: %v", i, err)
+		}
+		key, err := decodePKCS12(buf, DefaultPKCS12Password)
+		if err != nil {
+			t.Fatalf("test %d (%s) expected no error, got: %v", i, test, err)
+		}
+		if k, ok := key.(*rsa.PrivateKey); !ok || !k.Equal(want) {
+			t.Errorf("test %d (%s) decoded key does not match testdata/key.pem", i, test)
+		}
+		if _, err := decodePKCS12(buf, "bad"); err == nil {
+			t.Errorf("test %d (%s) expected error for incorrect password", i, test)
+		}
+		u, err := NewURLSigner(WithPKCS12(test, ""), WithClientEmail("test@example.com"))
+		if err != nil {
+			t.Fatalf("test %d (%s) expected no error, got: %v", i, test, err)
+		}
+		if !u.PrivateKey.Equal(want) {
+			t.Errorf("test %d (%s) WithPKCS12 key does not match testdata/key.pem", i, test)
+		}
+	}
+}
+
+func TestPKCS12KDF(t *testing.T) {
+	// the first vector is the well-known PKCS#12 test vector, the others were
+	// generated with:
+	//
+	//   openssl kdf -keylen <n> -kdfopt digest:<hash> -kdfopt hexpass:<bmp> \
+	//     -kdfopt hexsalt:<salt> -kdfopt iter:<iter> -kdfopt id:<id> PKCS12KDF
+	tests := []struct {
+		hash crypto.Hash
+		pass string
+		salt string
+		iter int
+		id   byte
+		exp  string
+	}{
+		{crypto.SHA1, "smeg", "0a58cf64530d823f", 1, 1, "8aaae6297b6cb04642ab5b077851284eb7128f1a2a7fbca3"},
+		{crypto.SHA1, "smeg", "0a58cf64530d823f", 1, 2, "79993dfe048d3b76ba33edf670c54ca09c58cb5cf20fc18c"},
+		{crypto.SHA1, "smeg", "0a58cf64530d823f", 1, 3, "9ba6ef317b8cb9f4760ab2fa2e51c066f0dce645fbeffc7f"},
+		{crypto.SHA256, "notasecret", "0102030405060708", 2048, 3, "c73aab119f7fe0b90b58ab6bbbe0329baf9e50249a438c036ee84779e0942dfb"},
+	}
+	for i, test := range tests {
+		salt, _ := hex.DecodeString(test.salt)
+		exp, _ := hex.DecodeString(test.exp)
+		key := pkcs12KDF(test.hash, bmpString(test.pass), salt, test.iter, test.id, len(exp))
+		if !bytes.Equal(key, exp) {
+			t.Errorf("test %d expected %x, got: %x", i, exp, key)
+		}
+	}
+}
+
+func TestBERToDER(t *testing.T) {
+	tests := []struct {
+		in, exp []byte
+	}{
+		// definite length is unchanged
+		{
+			[]byte{0x30, 0x03, 0x02, 0x01, 0x05},
+			[]byte{0x30, 0x03, 0x02, 0x01, 0x05},
+		},
+		// nested indefinite length
+		{
+			[]byte{0x30, 0x80, 0x02, 0x01, 0x05, 0x30, 0x80, 0x04, 0x01, 0xaa, 0x00, 0x00, 0x00, 0x00},
+			[]byte{0x30, 0x08, 0x02, 0x01, 0x05, 0x30, 0x03, 0x04, 0x01, 0xaa},
+		},
+	}
+	for i, test := range tests {
+		out, err := berToDER(test.in)
+		if err != nil {
+			t.Fatalf("test %d expected no error, got: %v", i, err)
+		}
+		if !bytes.Equal(out, test.exp) {
+			t.Errorf("test %d expected %x, got: %x", i, test.exp, out)
+		}
+	}
+	if _, err := berToDER([]byte{0x30, 0x80, 0x02, 0x01}); err == nil {
+		t.Error("expected error for truncated input")
+	}
+}
@@ -0,0 +1,190 @@
+package gstorage
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC     = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int                      `asn1:"optional"`
+	PRF        pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// decodePEMKey decodes a PEM encoded private key, decrypting it with the
+// passphrase when encrypted.
+func decodePEMKey(buf, passphrase []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(buf)
+	if block == nil {
+		return nil, errors.New("invalid pem data")
+	}
+	der := block.Bytes
+	switch {
+	case block.Type == "ENCRYPTED PRIVATE KEY":
+		var err error
+		if der, err = decryptPrivateKeyInfo(der, passphrase); err != nil {
+			return nil, err
+		}
+		return parsePrivateKeyBlock("PRIVATE KEY", der)
+	case x509.IsEncryptedPEMBlock(block):
+		var err error
+		if der, err = x509.DecryptPEMBlock(block, passphrase); err != nil {
+			return nil, err
+		}
+	}
+	return parsePrivateKeyBlock(block.Type, der)
+}
+
+// decryptPrivateKeyInfo decrypts a DER encoded EncryptedPrivateKeyInfo,
+// returning the DER encoded PrivateKeyInfo.
+func decryptPrivateKeyInfo(buf, password []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(buf, &info); err != nil {
+		return nil, fmt.Errorf("invalid encrypted private key: %v", err)
+	}
+	return pbeDecrypt(info.Algorithm, info.EncryptedData, password)
+}
+
+// pbeDecrypt decrypts buf using the password based encryption algorithm.
+func pbeDecrypt(alg pkix.AlgorithmIdentifier, buf, password []byte) ([]byte, error) {
+	switch {
+	case alg.Algorithm.Equal(oidPBES2):
+		return pbes2Decrypt(alg, buf, password)
+	case alg.Algorithm.Equal(oidPBEWithSHAAnd3KeyTDES):
+		return pkcs12Decrypt(alg, buf, password)
+	}
+	return nil, fmt.Errorf("unsupported encryption algorithm %v", alg.Algorithm)
+}
+
+// pbes2Decrypt decrypts buf using the PBES2 password based encryption
+// scheme, as described in RFC 8018.
+func pbes2Decrypt(alg pkix.AlgorithmIdentifier, buf, password []byte) ([]byte, error) {
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(alg.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("invalid pbes2 parameters: %v", err)
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported pbes2 key derivation function %v", params.KeyDerivationFunc.Algorithm)
+	}
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, fmt.Errorf("invalid pbkdf2 parameters: %v", err)
+	}
+	var hash crypto.Hash
+	switch prf := kdf.PRF.Algorithm; {
+	case len(prf) == 0, prf.Equal(oidHMACWithSHA1):
+		hash = crypto.SHA1
+	case prf.Equal(oidHMACWithSHA256):
+		hash = crypto.SHA256
+	case prf.Equal(oidHMACWithSHA384):
+		hash = crypto.SHA384
+	case prf.Equal(oidHMACWithSHA512):
+		hash = crypto.SHA512
+	default:
+		return nil, fmt.Errorf("unsupported pbkdf2 prf %v", prf)
+	}
+	var newCipher func([]byte) (cipher.Block, error)
+	var keyLen int
+	switch enc := params.EncryptionScheme.Algorithm; {
+	case enc.Equal(oidAES128CBC):
+		newCipher, keyLen = aes.NewCipher, 16
+	case enc.Equal(oidAES192CBC):
+		newCipher, keyLen = aes.NewCipher, 24
+	case enc.Equal(oidAES256CBC):
+		newCipher, keyLen = aes.NewCipher, 32
+	case enc.Equal(oidDESEDE3CBC):
+		newCipher, keyLen = des.NewTripleDESCipher, 24
+	default:
+		return nil, fmt.Errorf("unsupported pbes2 encryption scheme %v", enc)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, fmt.Errorf("invalid pbes2 encryption scheme iv: %v", err)
+	}
+	block, err := newCipher(pbkdf2(hash, password, kdf.Salt, kdf.Iterations, keyLen))
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() {
+		return nil, errors.New("invalid pbes2 encryption scheme iv length")
+	}
+	return cbcDecrypt(block, iv, buf)
+}
+
+// pbkdf2 derives a key of keyLen bytes from the password and salt, as
+// described in RFC 8018.
+func pbkdf2(hash crypto.Hash, password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(hash.New, password)
+	n := prf.Size()
+	var buf [4]byte
+	var key []byte
+	u := make([]byte, 0, n)
+	for i := uint32(1); len(key) < keyLen; i++ {
+		prf.Reset()
+		_, _ = prf.Write(salt)
+		binary.BigEndian.PutUint32(buf[:], i)
+		_, _ = prf.Write(buf[:])
+		key = prf.Sum(key)
+		t := key[len(key)-n:]
+		u = append(u[:0], t...)
+		for j := 1; j < iterations; j++ {
+			prf.Reset()
+			_, _ = prf.Write(u)
+			u = prf.Sum(u[:0])
+			for k := range u {
+				t[k] ^= u[k]
+			}
+		}
+	}
+	return key[:keyLen]
+}
+
+// cbcDecrypt decrypts buf using block in CBC mode, removing the PKCS#7
+// padding.
+func cbcDecrypt(block cipher.Block, iv, buf []byte) ([]byte, error) {
+	if len(buf) == 0 || len(buf)%block.BlockSize() != 0 {
+		return nil, errors.New("encrypted data is not a multiple of the block size")
+	}
+	out := make([]byte, len(buf))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, buf)
+	n := int(out[len(out)-1])
+	if n == 0 || n > block.BlockSize() || !bytes.Equal(out[len(out)-n:], bytes.Repeat([]byte{byte(n)}, n)) {
+		return nil, errors.New("decryption failed (incorrect password?)")
+	}
+	return out[:len(out)-n], nil
+}
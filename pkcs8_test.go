@@ -0,0 +1,76 @@
+package gstorage
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"encoding/hex"
+	"io/ioutil"
+	"testing"
+)
+
+// The encrypted .pem files in testdata/ were generated with OpenSSL 3.0 from
+// testdata/key.pem, using the passphrase "secret":
+//
+//   openssl pkcs8 -topk8 -v2 aes-256-cbc -v2prf hmacWithSHA256 -passout pass:secret -out enc_aes.pem
+//   openssl pkcs8 -topk8 -v2 des3 -passout pass:secret -out enc_3des.pem
+//   openssl pkcs8 -topk8 -v1 PBE-SHA1-3DES -passout pass:secret -out enc_p12.pem
+//   openssl rsa -des3 -traditional -passout pass:secret -out enc_legacy.pem
+
+func TestDecodePEMKey(t *testing.T) {
+	want := loadTestKey(t)
+	tests := []string{
+		"testdata/enc_aes.pem",
+		"testdata/enc_3des.pem",
+		"testdata/enc_p12.pem",
+		"testdata/enc_legacy.pem",
+	}
+	for i, test := range tests {
+		buf, err := ioutil.ReadFile(test)
+		if err != nil {
+			t.Fatalf("test %d expected no error, got: %v", i, err)
+		}
+		key, err := decodePEMKey(buf, []byte("secret"))
+		if err != nil {
+			t.Fatalf("test %d (%s) expected no error, got: %v", i, test, err)
+		}
+		if k, ok := key.(*rsa.PrivateKey); !ok || !k.Equal(want) {
+			t.Errorf("test %d (%s) decoded key does not match testdata/key.pem", i, test)
+		}
+		if _, err := decodePEMKey(buf, []byte("bad")); err == nil {
+			t.Errorf("test %d (%s) expected error for incorrect passphrase", i, test)
+		}
+		u, err := NewURLSigner(WithPEMPassphrase(buf, []byte("secret")), WithClientEmail("test@example.com"))
+		if err != nil {
+			t.Fatalf("test %d (%s) expected no error, got: %v", i, test, err)
+		}
+		if !u.PrivateKey.Equal(want) {
+			t.Errorf("test %d (%s) WithPEMPassphrase key does not match testdata/key.pem", i, test)
+		}
+	}
+}
+
+func TestPBKDF2(t *testing.T) {
+	// vectors from RFC 6070 (SHA-1) and RFC 7914 section 11 (SHA-256)
+	tests := []struct {
+		hash     crypto.Hash
+		password string
+		salt     string
+		iter     int
+		exp      string
+	}{
+		{crypto.SHA1, "password", "salt", 1, "0c60c80f961f0e71f3a9b524af6012062fe037a6"},
+		{crypto.SHA1, "password", "salt", 2, "ea6c014dc72d6f8ccd1ed92ace1d41f0d8de8957"},
+		{crypto.SHA1, "password", "salt", 4096, "4b007901b765489abead49d926f721d065a429c1"},
+		{crypto.SHA1, "passwordPASSWORDpassword", "saltSALTsaltSALTsaltSALTsaltSALTsalt", 4096, "3d2eec4fe41c849b80c8d83662c0e44a8b291a964cf2f07038"},
+		{crypto.SHA1, "pass\x00word", "sa\x00lt", 4096, "56fa6aa75548099dcc37d7f03425e0c3"},
+		{crypto.SHA256, "passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+	}
+	for i, test := range tests {
+		exp, _ := hex.DecodeString(test.exp)
+		key := pbkdf2(test.hash, []byte(test.password), []byte(test.salt), test.iter, len(exp))
+		if !bytes.Equal(key, exp) {
+			t.Errorf("test %d expected %x, got: %x", i, exp, key)
+		}
+	}
+}
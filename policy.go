@@ -0,0 +1,166 @@
+package gstorage
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// Policy is a set of restrictions on the requests a URLSigner will sign.
+type Policy struct {
+	// Methods are the allowed HTTP methods. If empty, then all methods are
+	// allowed.
+	Methods []string
+
+	// Prefixes are the allowed object path prefixes. Prefixes match on a path
+	// boundary, so that the prefix a/b allows a/b and a/b/c, but not a/bc. If
+	// empty, then all objects are allowed.
+	Prefixes []string
+
+	// ContentTypes are the allowed content types for uploads (PUT and POST
+	// requests). Types may use a wildcard subtype (eg, image/*). If empty,
+	// then all content types are allowed.
+	ContentTypes []string
+
+	// RequireHash requires the md5 hash to be set for PUT requests, so that
+	// clients must send the Content-MD5 header.
+	RequireHash bool
+
+	// RequireContentType requires the content type to be set for PUT
+	// requests, so that clients must send the Content-Type header.
+	RequireContentType bool
+}
+
+// check checks that the policy allows the signing params.
+func (policy Policy) check(p *SigningParams) error {
+	if len(policy.Methods) != 0 && !containsFold(policy.Methods, p.Method) {
+		return &PolicyError{Method: p.Method, Bucket: p.Bucket, Object: p.Object, Reason: "method not allowed"}
+	}
+	if len(policy.Prefixes) != 0 {
+		object := strings.TrimPrefix(p.Object, "/")
+		var ok bool
+		for _, prefix := range policy.Prefixes {
+			if ok = hasPathPrefix(object, strings.TrimPrefix(prefix, "/")); ok {
+				break
+			}
+		}
+		if !ok {
+			return &PolicyError{Method: p.Method, Bucket: p.Bucket, Object: p.Object, Reason: "path not allowed"}
+		}
+	}
+	if len(policy.ContentTypes) != 0 && (strings.EqualFold(p.Method, "PUT") || strings.EqualFold(p.Method, "POST")) {
+		if !matchContentType(policy.ContentTypes, p.ContentType) {
+			return &ContentTypeError{ContentType: p.ContentType, Allowed: policy.ContentTypes}
+		}
+	}
+	if strings.EqualFold(p.Method, "PUT") {
+		switch {
+		case policy.RequireHash && p.Hash == "":
+			return &PolicyError{Method: p.Method, Bucket: p.Bucket, Object: p.Object, Reason: "missing md5 hash"}
+		case policy.RequireContentType && p.ContentType == "":
+			return &PolicyError{Method: p.Method, Bucket: p.Bucket, Object: p.Object, Reason: "missing content type"}
+		}
+	}
+	return nil
+}
+
+// hasPathPrefix returns true when prefix is a path prefix of object, ending
+// at a / boundary.
+func hasPathPrefix(object, prefix string) bool {
+	switch {
+	case prefix == "" || object == prefix:
+		return true
+	case strings.HasSuffix(prefix, "/"):
+		return strings.HasPrefix(object, prefix)
+	}
+	return strings.HasPrefix(object, prefix+"/")
+}
+
+// matchContentType returns true when the media type of contentType matches
+// one of the allowed types.
+func matchContentType(allowed []string, contentType string) bool {
+	typ, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, s := range allowed {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if s == typ || (strings.HasSuffix(s, "/*") && strings.HasPrefix(typ, s[:len(s)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// PolicyError is the error returned when signing params are not allowed by a
+// URLSigner's policy.
+type PolicyError struct {
+	Method string
+	Bucket string
+	Object string
+	Reason string
+}
+
+// Error satisfies the error interface.
+func (err *PolicyError) Error() string {
+	return fmt.Sprintf("%s /%s/%s: %s", err.Method, strings.Trim(err.Bucket, "/"), strings.TrimPrefix(err.Object, "/"), err.Reason)
+}
+
+// ContentTypeError is the error returned when an upload's content type is
+// not allowed by a URLSigner's policy.
+type ContentTypeError struct {
+	ContentType string
+	Allowed     []string
+}
+
+// Error satisfies the error interface.
+func (err *ContentTypeError) Error() string {
+	return fmt.Sprintf("content type %q not allowed (allowed: %s)", err.ContentType, strings.Join(err.Allowed, ", "))
+}
+
+// Scoped returns a copy of the URLSigner restricted to signing requests
+// allowed by the policy. Restrictions of the URLSigner are retained, so a
+// scoped signer can only be narrowed further.
+//
+// The scoped signer does not expose the URLSigner's private key, signer, or
+// backend, and instead signs through the URLSigner.
+func (u *URLSigner) Scoped(policy Policy) *URLSigner {
+	s := *u
+	s.PrivateKey, s.Signer, s.Backend = nil, nil, &scopedBackend{u: u}
+	s.policies = append(append([]Policy(nil), u.policies...), policy)
+	return &s
+}
+
+// ReadOnly returns a copy of the URLSigner restricted to signing GET and
+// HEAD requests.
+func (u *URLSigner) ReadOnly() *URLSigner {
+	return u.Scoped(Policy{Methods: []string{"GET", "HEAD"}})
+}
+
+// scopedBackend is the backend of a scoped signer, signing with the parent
+// URLSigner.
+type scopedBackend struct {
+	u *URLSigner
+}
+
+// SignBytes satisfies the Backend interface.
+func (b *scopedBackend) SignBytes(ctx context.Context, buf []byte) ([]byte, error) {
+	return b.u.sign(ctx, buf)
+}
+
+// VerifyBytes satisfies the Verifier interface.
+func (b *scopedBackend) VerifyBytes(_ crypto.Hash, buf, sig []byte) error {
+	return b.u.verifyBytes(buf, sig)
+}
+
+// containsFold returns true when v contains s, compared case-insensitively.
+func containsFold(v []string, s string) bool {
+	for _, z := range v {
+		if strings.EqualFold(z, s) {
+			return true
+		}
+	}
+	return false
+}
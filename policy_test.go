@@ -0,0 +1,91 @@
+package gstorage
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPolicyPrefixes(t *testing.T) {
+	tests := []struct {
+		prefix string
+		object string
+		exp    bool
+	}{
+		{"a/b", "a/b", true},
+		{"a/b", "a/b/c", true},
+		{"a/b", "/a/b/c", true},
+		{"/a/b", "a/b/c", true},
+		{"a/b", "a/bc", false},
+		{"a/b", "a/b.txt", false},
+		{"a/b", "a", false},
+		{"a/b/", "a/b/c", true},
+		{"a/b/", "a/bc", false},
+		{"a/b/", "a/b", false},
+		{"", "a", true},
+		{"/", "a", true},
+	}
+	for i, test := range tests {
+		policy := Policy{Prefixes: []string{test.prefix}}
+		err := policy.check(&SigningParams{Method: "GET", Bucket: "bucket", Object: test.object})
+		if test.exp && err != nil {
+			t.Errorf("test %d (%q, %q) expected no error, got: %v", i, test.prefix, test.object, err)
+		}
+		var perr *PolicyError
+		if !test.exp && !errors.As(err, &perr) {
+			t.Errorf("test %d (%q, %q) expected *PolicyError, got: %v", i, test.prefix, test.object, err)
+		}
+	}
+}
+
+func TestScoped(t *testing.T) {
+	u := &URLSigner{PrivateKey: loadTestKey(t), ClientEmail: "test@example.com"}
+	s := u.Scoped(Policy{Prefixes: []string{"public"}}).ReadOnly()
+	if s.PrivateKey != nil || s.Signer != nil {
+		t.Fatal("expected scoped signer to not expose the private key or signer")
+	}
+	if _, ok := s.Backend.(*scopedBackend); !ok {
+		t.Fatalf("expected scoped signer backend to be *scopedBackend, got: %T", s.Backend)
+	}
+	p := &SigningParams{
+		Method:     "GET",
+		Bucket:     "bucket",
+		Object:     "public/file.txt",
+		Expiration: time.Now().Add(time.Hour),
+	}
+	exp, err := u.SigningParams(p)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	sig, err := s.SigningParams(p)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if sig != exp {
+		t.Errorf("expected scoped signature %q, got: %q", exp, sig)
+	}
+	if err := s.Verify(p, sig); err != nil {
+		t.Errorf("expected no error, got: %v", err)
+	}
+	if info, exp := s.KeyInfo(), u.KeyInfo(); info != exp {
+		t.Errorf("expected key info %v, got: %v", exp, info)
+	}
+	tests := []struct {
+		method string
+		object string
+	}{
+		{"PUT", "public/file.txt"},
+		{"DELETE", "public/file.txt"},
+		{"GET", "publicfile.txt"},
+		{"GET", "private/file.txt"},
+	}
+	for i, test := range tests {
+		q := *p
+		q.Method, q.Object = test.method, test.object
+		_, err := s.SigningParams(&q)
+		var perr *PolicyError
+		if !errors.As(err, &perr) {
+			t.Errorf("test %d expected *PolicyError, got: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package gstorage
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// canonicalQuery encodes the query values as Google Cloud Storage expects for
+// both V2 and V4 signed URLs, ordered by key (and by value for repeated
+// keys), with keys and values escaped using escapeQuery.
+func canonicalQuery(v url.Values) string {
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	for _, k := range keys {
+		vals := append([]string(nil), v[k]...)
+		sort.Strings(vals)
+		for _, z := range vals {
+			if sb.Len() != 0 {
+				sb.WriteByte('&')
+			}
+			sb.WriteString(escapeQuery(k) + "=" + escapeQuery(z))
+		}
+	}
+	return sb.String()
+}
+
+// escapeQuery percent-encodes all bytes of s other than the RFC 3986
+// unreserved characters.
+func escapeQuery(s string) string {
+	const hexDigits = "0123456789ABCDEF"
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~':
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte('%')
+			sb.WriteByte(hexDigits[c>>4])
+			sb.WriteByte(hexDigits[c&15])
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,210 @@
+package gstorage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultReceiverMaxSize is the default maximum upload size for a
+	// Receiver.
+	DefaultReceiverMaxSize = 100 << 20
+
+	// DefaultReceiverConcurrency is the default maximum number of uploads a
+	// Receiver spools and pushes at the same time.
+	DefaultReceiverConcurrency = 8
+)
+
+// Receiver is a http.Handler that accepts uploads on a service's own domain,
+// spooling the uploaded content to disk and responding with 202 Accepted,
+// and then asynchronously pushing the content to a bucket using a signed
+// resumable upload. This is intended for clients on networks that block
+// storage.googleapis.com.
+type Receiver struct {
+	// Signer is the URLSigner used for uploads.
+	Signer *URLSigner
+
+	// Bucket is the destination bucket.
+	Bucket string
+
+	// Dir is the spool directory. If empty, then the system's temporary
+	// directory will be used instead.
+	Dir string
+
+	// MaxSize is the maximum upload size. If 0, then DefaultReceiverMaxSize
+	// will be used instead. If negative, then the upload size is not
+	// limited.
+	MaxSize int64
+
+	// Concurrency is the maximum number of uploads being spooled or pushed
+	// at the same time. Uploads exceeding the limit are rejected with 503
+	// Service Unavailable. If 0, then DefaultReceiverConcurrency will be used
+	// instead.
+	Concurrency int
+
+	// Context is the context for pushing uploads to the bucket, such as a
+	// server's shutdown context. If nil, then the request's context values
+	// are used, without its cancellation, as the request completes before
+	// the upload is pushed.
+	Context context.Context
+
+	// Object returns the object path for the request. If not supplied, then
+	// the request's URL path will be used instead.
+	Object func(*http.Request) (string, error)
+
+	// OnComplete is called after an upload has been pushed to the bucket, or
+	// has failed.
+	OnComplete func(object string, res *ImportResult, err error)
+
+	wg   sync.WaitGroup
+	once sync.Once
+	sem  chan struct{}
+}
+
+// ServeHTTP satisfies the http.Handler interface.
+func (rc *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "PUT" && req.Method != "POST" {
+		w.Header().Set("Allow", "PUT, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	// determine object
+	object := strings.TrimPrefix(req.URL.Path, "/")
+	if rc.Object != nil {
+		var err error
+		if object, err = rc.Object(req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if err := ValidateObjectName(object); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	contentType := req.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	// check the signer's name validators and policies before spooling
+	if err := rc.Signer.check(&SigningParams{Method: "POST", Bucket: rc.Bucket, Object: object, ContentType: contentType}, false); err != nil {
+		status := http.StatusBadRequest
+		var perr *PolicyError
+		var cerr *ContentTypeError
+		switch {
+		case errors.As(err, &cerr):
+			status = http.StatusUnsupportedMediaType
+		case errors.As(err, &perr):
+			status = http.StatusForbidden
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	maxSize := rc.MaxSize
+	if maxSize == 0 {
+		maxSize = DefaultReceiverMaxSize
+	}
+	if maxSize > 0 && req.ContentLength > maxSize {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+	// acquire
+	rc.once.Do(func() {
+		n := rc.Concurrency
+		if n <= 0 {
+			n = DefaultReceiverConcurrency
+		}
+		rc.sem = make(chan struct{}, n)
+	})
+	select {
+	case rc.sem <- struct{}{}:
+	default:
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	release := func() { <-rc.sem }
+	// spool
+	var r io.Reader = req.Body
+	if maxSize > 0 {
+		r = http.MaxBytesReader(w, req.Body, maxSize)
+	}
+	f, err := ioutil.TempFile(rc.Dir, "gstorage-upload-")
+	if err != nil {
+		release()
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if n, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		release()
+		if maxSize > 0 && n >= maxSize {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "could not read upload", http.StatusBadRequest)
+		return
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		release()
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	// push
+	ctx := rc.Context
+	if ctx == nil {
+		ctx = valuesContext{req.Context()}
+	}
+	rc.wg.Add(1)
+	go func() {
+		defer rc.wg.Done()
+		defer release()
+		defer os.Remove(f.Name())
+		defer f.Close()
+		res, err := rc.Signer.resumableUpload(ctx, f, rc.Bucket, object, contentType)
+		if rc.OnComplete != nil {
+			rc.OnComplete(object, res, err)
+		}
+	}()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Wait waits for all pending uploads to complete.
+func (rc *Receiver) Wait() {
+	rc.wg.Wait()
+}
+
+// valuesContext is a context having the values of its parent context, but
+// not its deadline or cancellation.
+type valuesContext struct {
+	parent context.Context
+}
+
+// Deadline satisfies the context.Context interface.
+func (valuesContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+// Done satisfies the context.Context interface.
+func (valuesContext) Done() <-chan struct{} {
+	return nil
+}
+
+// Err satisfies the context.Context interface.
+func (valuesContext) Err() error {
+	return nil
+}
+
+// Value satisfies the context.Context interface.
+func (ctx valuesContext) Value(key interface{}) interface{} {
+	return ctx.parent.Value(key)
+}
@@ -0,0 +1,118 @@
+package gstorage
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+// newTestUploadServer creates a test server accepting resumable uploads,
+// blocking each upload until a value is received on release.
+func newTestUploadServer(t *testing.T, release <-chan struct{}) *httptest.Server {
+	t.Helper()
+	var s *httptest.Server
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.Method == "POST" && req.Header.Get("x-goog-resumable") == "start":
+			w.Header().Set("Location", s.URL+"/session")
+			w.WriteHeader(http.StatusCreated)
+		case req.Method == "PUT" && req.URL.Path == "/session":
+			if _, err := ioutil.ReadAll(req.Body); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			<-release
+			w.WriteHeader(http.StatusOK)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestReceiver(t *testing.T) {
+	release := make(chan struct{})
+	s := newTestUploadServer(t, release)
+	u := &URLSigner{PrivateKey: loadTestKey(t), ClientEmail: "test@example.com"}
+	for _, o := range []Option{
+		WithBaseURL(s.URL),
+		WithNameValidator(NameRegexp(regexp.MustCompile(`^uploads/`))),
+		WithAllowedContentTypes("text/plain", "application/octet-stream"),
+	} {
+		if err := o(u); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+	var errs []error
+	rc := &Receiver{
+		Signer:      u,
+		Bucket:      "bucket",
+		Concurrency: 1,
+		OnComplete: func(_ string, _ *ImportResult, err error) {
+			errs = append(errs, err)
+		},
+	}
+	tests := []struct {
+		path        string
+		contentType string
+		length      int64
+		exp         int
+	}{
+		{"/..", "", 0, http.StatusBadRequest},
+		{"/.well-known/acme-challenge/token", "", 0, http.StatusBadRequest},
+		{"/other/file.txt", "", 0, http.StatusForbidden},
+		{"/uploads/file.txt", "", DefaultReceiverMaxSize + 1, http.StatusRequestEntityTooLarge},
+		{"/uploads/file.txt", "text/plain", DefaultReceiverMaxSize + 1, http.StatusRequestEntityTooLarge},
+		{"/uploads/file.png", "image/png", 0, http.StatusUnsupportedMediaType},
+	}
+	for i, test := range tests {
+		req := httptest.NewRequest("PUT", "http://localhost/", nil)
+		req.URL.Path = test.path
+		if test.contentType != "" {
+			req.Header.Set("Content-Type", test.contentType)
+		}
+		if test.length != 0 {
+			req.ContentLength = test.length
+		}
+		w := httptest.NewRecorder()
+		rc.ServeHTTP(w, req)
+		if w.Code != test.exp {
+			t.Errorf("test %d expected status %d, got: %d %s", i, test.exp, w.Code, w.Body.String())
+		}
+	}
+	// upload pushed after the request's context is closed
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("PUT", "http://localhost/uploads/file.txt", bytes.NewReader([]byte("hello")))
+	req.Header.Set("Content-Type", "text/plain")
+	w := httptest.NewRecorder()
+	rc.ServeHTTP(w, req.WithContext(ctx))
+	cancel()
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got: %d %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+	// concurrency limit
+	w = httptest.NewRecorder()
+	rc.ServeHTTP(w, httptest.NewRequest("PUT", "http://localhost/uploads/other.txt", bytes.NewReader([]byte("hello"))))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got: %d", http.StatusServiceUnavailable, w.Code)
+	}
+	release <- struct{}{}
+	rc.Wait()
+	if len(errs) != 1 || errs[0] != nil {
+		t.Fatalf("expected 1 completed upload, got: %v", errs)
+	}
+	// explicit max size, without a content length
+	rc.MaxSize = 4
+	req = httptest.NewRequest("PUT", "http://localhost/uploads/file.txt", bytes.NewReader([]byte("hello")))
+	req.ContentLength = -1
+	w = httptest.NewRecorder()
+	rc.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status %d, got: %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+}
@@ -0,0 +1,120 @@
+package gstorage
+
+import (
+	"context"
+	"crypto"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// WithKeyRefresh is an option that loads credentials using load, and
+// periodically reloads the credentials (at a jittered interval) until the
+// context is closed, atomically swapping the private key when the loaded key
+// changes. This is intended for short lived keys that are rotated by an
+// external system.
+//
+// The loaded credentials may be JSON encoded Google Service Account
+// credentials (see WithCredentialsJSON), or a PEM or DER encoded private key
+// (see WithPrivateKey). Reloads that fail, have a different client email than
+// the initial credentials, or have keys weaker than the minimum key size are
+// ignored until the next reload. See WithOnRotate for tracking rotations.
+//
+// Reloading only starts once NewURLSigner has successfully returned.
+func WithKeyRefresh(ctx context.Context, interval time.Duration, load func(context.Context) ([]byte, error)) Option {
+	return func(u *URLSigner) error {
+		if interval <= 0 {
+			return fmt.Errorf("invalid refresh interval %v", interval)
+		}
+		buf, err := load(ctx)
+		if err != nil {
+			return fmt.Errorf("could not load credentials: %v", err)
+		}
+		key, email, keyID, err := parseKeyFile(buf)
+		if err != nil {
+			return fmt.Errorf("could not load credentials: %v", err)
+		}
+		if email != "" {
+			u.ClientEmail = email
+		}
+		b := newKeyBackend(key, keyID)
+		u.PrivateKey, u.Signer, u.Backend = nil, nil, b
+		u.refreshKey(ctx, b, email, interval, func(ctx context.Context) (crypto.Signer, string, string, error) {
+			buf, err := load(ctx)
+			if err != nil {
+				return nil, "", "", err
+			}
+			return parseKeyFile(buf)
+		})
+		return nil
+	}
+}
+
+// WithOnRotate is an option that sets a func called with the new key's
+// information each time a refreshed private key is swapped in, such as by
+// WithKeyFileReload, WithSecretManagerKeyRefresh, or WithKeyRefresh, for
+// tracking credential turnover in metrics or logs.
+func WithOnRotate(f func(KeyInfo)) Option {
+	return func(u *URLSigner) error {
+		u.onRotate = f
+		return nil
+	}
+}
+
+// refreshKey registers a goroutine, started once NewURLSigner has
+// successfully constructed the URLSigner, that periodically reloads the
+// private key using load, at a jittered interval, until the context is
+// closed. Loaded keys are swapped into the key backend when the key differs
+// from the current key, the client email matches, and the key is not weaker
+// than the minimum key size. A nil key returned by load is ignored.
+//
+// The client email, minimum key size, and rotation func are captured when
+// the goroutine is started, after all options have been applied.
+func (u *URLSigner) refreshKey(ctx context.Context, b *keyBackend, email string, interval time.Duration, load func(context.Context) (crypto.Signer, string, string, error)) {
+	u.start = append(u.start, func() {
+		clientEmail, minKeyBits, onRotate := u.ClientEmail, u.minKeyBits, u.onRotate
+		go func() {
+			for {
+				if err := sleep(ctx, u.jitter(interval)); err != nil {
+					return
+				}
+				key, e, keyID, err := load(ctx)
+				if err != nil || key == nil || e != email || checkKeyBits(key, minKeyBits) != nil {
+					continue
+				}
+				cur := b.current()
+				fp := fingerprint(key.Public())
+				if fp == fingerprint(cur.Signer.Public()) && keyID == cur.ID {
+					continue
+				}
+				b.swap(key, keyID)
+				if onRotate != nil {
+					onRotate(KeyInfo{ClientEmail: clientEmail, KeyID: keyID, Fingerprint: fp})
+				}
+			}
+		}()
+	})
+}
+
+// jitter returns d randomly adjusted by up to ±10%, using the URLSigner's
+// random source.
+func (u *URLSigner) jitter(d time.Duration) time.Duration {
+	if d < 10 {
+		return d
+	}
+	return d - d/10 + u.randDuration(d/5)
+}
+
+// randDuration returns a random duration in [0, max), using the URLSigner's
+// random source. If the random source fails, then 0 is returned.
+func (u *URLSigner) randDuration(max time.Duration) time.Duration {
+	var buf [8]byte
+	if max <= 0 {
+		return 0
+	}
+	if _, err := io.ReadFull(u.random(), buf[:]); err != nil {
+		return 0
+	}
+	return time.Duration(binary.BigEndian.Uint64(buf[:]) % uint64(max))
+}
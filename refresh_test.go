@@ -0,0 +1,73 @@
+package gstorage
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithKeyRefresh(t *testing.T) {
+	key, err := ioutil.ReadFile("testdata/key.pem")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	next, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(next)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	nextKey := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	// failed construction does not start refreshing
+	var loads int32
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	load := func(context.Context) ([]byte, error) {
+		if atomic.AddInt32(&loads, 1) == 1 {
+			return key, nil
+		}
+		return nextKey, nil
+	}
+	if _, err := NewURLSigner(WithKeyRefresh(ctx, time.Millisecond, load)); err != ErrMissingClientEmail {
+		t.Fatalf("expected ErrMissingClientEmail, got: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Errorf("expected 1 load for failed construction, got: %d", n)
+	}
+	// options applied after WithKeyRefresh are used by the refresh
+	atomic.StoreInt32(&loads, 0)
+	rotated := make(chan KeyInfo, 1)
+	u, err := NewURLSigner(
+		WithKeyRefresh(ctx, time.Millisecond, load),
+		WithClientEmail("test@example.com"),
+		WithOnRotate(func(info KeyInfo) {
+			select {
+			case rotated <- info:
+			default:
+			}
+		}),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	select {
+	case info := <-rotated:
+		if info.ClientEmail != "test@example.com" || info.Fingerprint != fingerprint(next.Public()) {
+			t.Errorf("expected rotation to the next key, got: %+v", info)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected key rotation")
+	}
+	if !u.Backend.(*keyBackend).current().Signer.Public().(*rsa.PublicKey).Equal(next.Public()) {
+		t.Error("expected backend to use the next key")
+	}
+}
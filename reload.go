@@ -0,0 +1,82 @@
+package gstorage
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// DefaultReloadInterval is the default interval for checking a key file for
+// changes.
+const DefaultReloadInterval = 30 * time.Second
+
+// WithKeyFileReload is an option that loads a private key from the specified
+// file, and periodically checks the file for changes until the context is
+// closed, atomically swapping the private key when the file changes. If
+// interval is 0, then DefaultReloadInterval will be used instead, and a
+// negative interval is an error.
+//
+// The file may contain JSON encoded Google Service Account credentials (see
+// WithCredentialsJSON), or a PEM or DER encoded private key (see
+// WithPrivateKey). When the file contains a private key, the client email
+// must be set separately with WithClientEmail.
+//
+// This is intended for long running servers where keys are rotated on disk,
+// such as a Kubernetes secret mounted as a volume. Files that fail to load
+// (for example, a partially written file) are ignored until the next check,
+// as are credentials having a different client email than the initial
+// credentials and keys weaker than the minimum key size. The file is not
+// checked for changes unless NewURLSigner succeeds.
+func WithKeyFileReload(ctx context.Context, path string, interval time.Duration) Option {
+	return func(u *URLSigner) error {
+		switch {
+		case interval == 0:
+			interval = DefaultReloadInterval
+		case interval < 0:
+			return fmt.Errorf("invalid reload interval %v", interval)
+		}
+		buf, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("could not read key file: %v", err)
+		}
+		key, email, keyID, err := parseKeyFile(buf)
+		if err != nil {
+			return fmt.Errorf("could not load key file: %v", err)
+		}
+		if email != "" {
+			u.ClientEmail = email
+		}
+		b := newKeyBackend(key, keyID)
+		u.PrivateKey, u.Signer, u.Backend = nil, nil, b
+		u.refreshKey(ctx, b, email, interval, func(context.Context) (crypto.Signer, string, string, error) {
+			next, err := ioutil.ReadFile(path)
+			if err != nil || bytes.Equal(buf, next) {
+				return nil, "", "", err
+			}
+			buf = next
+			return parseKeyFile(next)
+		})
+		return nil
+	}
+}
+
+// parseKeyFile parses a key file containing either JSON encoded Google
+// Service Account credentials or a PEM or DER encoded private key, returning
+// the private key, and the client email and private key id (if any).
+func parseKeyFile(buf []byte) (crypto.Signer, string, string, error) {
+	if b := bytes.TrimSpace(buf); len(b) != 0 && b[0] == '{' {
+		key, email, keyID, err := parseCredentialsJSON(b)
+		if err != nil {
+			return nil, "", "", err
+		}
+		return key, email, keyID, nil
+	}
+	key, err := parsePrivateKey(buf)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return key, "", "", nil
+}
@@ -0,0 +1,43 @@
+package gstorage
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWithKeyFileReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gstorage")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "credentials.json")
+	if err := ioutil.WriteFile(path, testCredentialsJSON(t), 0600); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tests := []struct {
+		interval time.Duration
+		err      bool
+	}{
+		{0, false},
+		{time.Minute, false},
+		{-time.Second, true},
+	}
+	for i, test := range tests {
+		u, err := NewURLSigner(WithKeyFileReload(ctx, path, test.interval))
+		switch {
+		case test.err && err == nil:
+			t.Errorf("test %d expected error", i)
+		case !test.err && err != nil:
+			t.Errorf("test %d expected no error, got: %v", i, err)
+		case !test.err && u.ClientEmail != "test@example.iam.gserviceaccount.com":
+			t.Errorf("test %d expected client email, got: %q", i, u.ClientEmail)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package gstorage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	b64 "encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// resumableChunkSize is the chunk size used for resumable uploads. Must be
+	// a multiple of 256 KiB.
+	resumableChunkSize = 32 * 256 * 1024
+
+	// resumableMaxRetries is the maximum number of retries for a chunk of a
+	// resumable upload.
+	resumableMaxRetries = 5
+)
+
+// ImportResult is the result of importing a remote URL into a bucket.
+type ImportResult struct {
+	// Bucket is the storage bucket.
+	Bucket string
+
+	// Object is the object path.
+	Object string
+
+	// ContentType is the content type of the imported object.
+	ContentType string
+
+	// Size is the number of bytes written.
+	Size int64
+
+	// MD5 is the base64 encoded md5 hash of the written content.
+	MD5 string
+
+	// CRC32C is the base64 encoded crc32c checksum of the written content.
+	CRC32C string
+
+	// Generation is the generation of the written object, if reported by
+	// the server.
+	Generation int64
+}
+
+// ImportURL streams the content of srcURL into the bucket and path using a
+// signed resumable upload, retrying failed chunks. The content is never
+// buffered to disk.
+func (u *URLSigner) ImportURL(ctx context.Context, srcURL, bucket, path string) (*ImportResult, error) {
+	req, err := http.NewRequest("GET", srcURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := u.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("could not retrieve %s: %s", srcURL, res.Status)
+	}
+	contentType := res.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return u.resumableUpload(ctx, res.Body, bucket, path, contentType)
+}
+
+// resumableUpload uploads the content of r to the bucket and path using a
+// signed resumable upload.
+func (u *URLSigner) resumableUpload(ctx context.Context, r io.Reader, bucket, path, contentType string) (*ImportResult, error) {
+	session, err := u.startResumable(ctx, bucket, path, contentType)
+	if err != nil {
+		return nil, err
+	}
+	md5h, crch := md5.New(), crc32.New(castagnoli)
+	buf := make([]byte, resumableChunkSize)
+	var off int64
+	for {
+		n, err := io.ReadFull(r, buf)
+		final := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !final {
+			return nil, err
+		}
+		chunk := buf[:n]
+		_, _ = md5h.Write(chunk)
+		_, _ = crch.Write(chunk)
+		res, err := u.putChunk(ctx, session, chunk, off, final)
+		if err != nil {
+			return nil, err
+		}
+		off += int64(n)
+		if !final {
+			continue
+		}
+		defer res.Body.Close()
+		result := &ImportResult{
+			Bucket:      bucket,
+			Object:      path,
+			ContentType: contentType,
+			Size:        off,
+			MD5:         sum(md5h),
+			CRC32C:      sum(crch),
+		}
+		// check server checksum
+		if crc := googHash(res.Header, "crc32c"); crc != "" && crc != result.CRC32C {
+			return nil, fmt.Errorf("crc32c mismatch for /%s/%s: expected %s, got %s", bucket, path, result.CRC32C, crc)
+		}
+		if s := strings.TrimSpace(res.Header.Get("x-goog-generation")); s != "" {
+			if result.Generation, err = strconv.ParseInt(s, 10, 64); err != nil {
+				return nil, fmt.Errorf("invalid generation %q", s)
+			}
+		}
+		return result, nil
+	}
+}
+
+// ResumableURL creates a signed URL for opening a resumable upload session
+// for the bucket and path, using a POST request with the x-goog-resumable:
+// start header. The client sends a POST request with an empty body to the
+// URL, with the returned headers, and uploads the content to the session URI
+// in the response's Location header. The session URI does not require
+// signing, and is valid for up to a week.
+//
+// When contentType is not empty, it is used as the uploaded object's content
+// type, and must be sent by the client.
+func (u *URLSigner) ResumableURL(bucket, path, contentType string, d time.Duration) (*SignedURL, error) {
+	return u.MakeSigned(&SigningParams{
+		Method:      "POST",
+		ContentType: contentType,
+		Headers:     http.Header{"x-goog-resumable": {"start"}},
+		Bucket:      bucket,
+		Object:      path,
+	}, d)
+}
+
+// startResumable opens a resumable upload session, returning the session
+// URI.
+func (u *URLSigner) startResumable(ctx context.Context, bucket, path, contentType string) (string, error) {
+	s, err := u.ResumableURL(bucket, path, contentType, u.defaultExpiration())
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest("POST", s.URL, nil)
+	if err != nil {
+		return "", err
+	}
+	for k, v := range s.Headers {
+		req.Header.Set(k, v)
+	}
+	res, err := u.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer drain(res)
+	if res.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("could not start resumable upload for /%s/%s: %s", bucket, path, res.Status)
+	}
+	session := res.Header.Get("Location")
+	if session == "" {
+		return "", errors.New("resumable upload response missing session location")
+	}
+	return session, nil
+}
+
+// putChunk writes chunk at off to the resumable upload session, retrying
+// failed and partially persisted writes. When final is true, the completed
+// upload's response is returned, and its body must be closed by the caller.
+func (u *URLSigner) putChunk(ctx context.Context, session string, chunk []byte, off int64, final bool) (*http.Response, error) {
+	total := int64(-1)
+	if final {
+		total = off + int64(len(chunk))
+	}
+	var sent int64
+	for attempt := 0; ; attempt++ {
+		res, err := u.doChunk(ctx, session, chunk[sent:], off+sent, total)
+		if err == nil {
+			switch {
+			case res.StatusCode == http.StatusOK || res.StatusCode == http.StatusCreated:
+				if final {
+					return res, nil
+				}
+				drain(res)
+				return nil, errors.New("resumable upload completed before final chunk")
+			case res.StatusCode == http.StatusPermanentRedirect:
+				drain(res)
+				n, perr := persisted(res.Header)
+				switch {
+				case perr != nil:
+					return nil, perr
+				case n < off || n > off+int64(len(chunk)):
+					return nil, fmt.Errorf("resumable upload persisted unexpected offset %d", n)
+				case !final && n == off+int64(len(chunk)):
+					return nil, nil
+				}
+				// partially persisted, send the remainder, counting against
+				// the retries so a server not making progress cannot loop
+				sent = n - off
+				if attempt >= resumableMaxRetries {
+					return nil, fmt.Errorf("resumable upload chunk partially persisted at offset %d", n)
+				}
+				if err := sleep(ctx, u.backoff(attempt)); err != nil {
+					return nil, err
+				}
+				continue
+			case res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500:
+				drain(res)
+				err = fmt.Errorf("resumable upload chunk failed: %s", res.Status)
+			default:
+				drain(res)
+				return nil, fmt.Errorf("resumable upload chunk failed: %s", res.Status)
+			}
+		}
+		if attempt >= resumableMaxRetries {
+			return nil, err
+		}
+		if err := sleep(ctx, u.backoff(attempt)); err != nil {
+			return nil, err
+		}
+		// query the persisted offset before retrying
+		res, err = u.doChunk(ctx, session, nil, -1, total)
+		if err != nil {
+			continue
+		}
+		if final && (res.StatusCode == http.StatusOK || res.StatusCode == http.StatusCreated) {
+			return res, nil
+		}
+		drain(res)
+		if res.StatusCode != http.StatusPermanentRedirect {
+			continue
+		}
+		if n, err := persisted(res.Header); err == nil && n >= off && n <= off+int64(len(chunk)) {
+			sent = n - off
+		}
+	}
+}
+
+// doChunk sends a chunk at off to the resumable upload session. When off is
+// -1, the upload status is queried. When total is -1, the total size of the
+// upload is not yet known.
+func (u *URLSigner) doChunk(ctx context.Context, session string, chunk []byte, off, total int64) (*http.Response, error) {
+	size := "*"
+	if total != -1 {
+		size = strconv.FormatInt(total, 10)
+	}
+	rng := "bytes */" + size
+	if off != -1 && len(chunk) != 0 {
+		rng = "bytes " + strconv.FormatInt(off, 10) + "-" + strconv.FormatInt(off+int64(len(chunk))-1, 10) + "/" + size
+	}
+	req, err := http.NewRequest("PUT", session, bytes.NewReader(chunk))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(chunk))
+	req.Header.Set("Content-Range", rng)
+	return u.client().Do(req.WithContext(ctx))
+}
+
+// persisted returns the number of bytes persisted by a resumable upload from
+// the Range header.
+func persisted(header http.Header) (int64, error) {
+	rng := header.Get("Range")
+	if rng == "" {
+		return 0, nil
+	}
+	i := strings.LastIndex(rng, "-")
+	if !strings.HasPrefix(rng, "bytes=") || i == -1 {
+		return 0, fmt.Errorf("invalid resumable upload range %q", rng)
+	}
+	n, err := strconv.ParseInt(rng[i+1:], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid resumable upload range %q", rng)
+	}
+	return n + 1, nil
+}
+
+// googHash returns the value for typ from the x-goog-hash header.
+func googHash(header http.Header, typ string) string {
+	for _, v := range header["X-Goog-Hash"] {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); strings.HasPrefix(s, typ+"=") {
+				return s[len(typ)+1:]
+			}
+		}
+	}
+	return ""
+}
+
+// sum returns the base64 encoded sum of h.
+func sum(h hash.Hash) string {
+	return b64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// drain drains and closes the response body.
+func drain(res *http.Response) {
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+}
+
+// backoff returns the jittered exponential backoff for attempt, using the
+// URLSigner's random source for the jitter.
+func (u *URLSigner) backoff(attempt int) time.Duration {
+	d := 500 * time.Millisecond << uint(attempt)
+	if d > 30*time.Second {
+		d = 30 * time.Second
+	}
+	return d/2 + u.randDuration(d/2)
+}
+
+// sleep sleeps for d or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,37 @@
+package gstorage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestStartResumableExpiration(t *testing.T) {
+	var expires string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		expires = req.URL.Query().Get("Expires")
+		w.Header().Set("Location", "http://localhost/session")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer s.Close()
+	now := time.Now()
+	u := &URLSigner{PrivateKey: loadTestKey(t), ClientEmail: "test@example.com"}
+	for _, o := range []Option{
+		WithBaseURL(s.URL),
+		WithClock(func() time.Time { return now }),
+		WithDefaultExpiration(5 * time.Minute),
+	} {
+		if err := o(u); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+	if _, err := u.startResumable(context.Background(), "bucket", "file.txt", "text/plain"); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if exp := strconv.FormatInt(now.Add(5*time.Minute).Unix(), 10); expires != exp {
+		t.Errorf("expected session url expiration %s, got: %s", exp, expires)
+	}
+}
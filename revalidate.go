@@ -0,0 +1,82 @@
+package gstorage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Revalidation is a pair of signed URLs for an object, along with the
+// object's validators, allowing downstream caches to serve content from a
+// long lived GET URL while cheaply revalidating with a short lived HEAD URL.
+type Revalidation struct {
+	// GetURL is the signed GET URL.
+	GetURL string
+
+	// GetExpiration is the expiration time of the GET URL.
+	GetExpiration time.Time
+
+	// HeadURL is the signed HEAD URL.
+	HeadURL string
+
+	// HeadExpiration is the expiration time of the HEAD URL.
+	HeadExpiration time.Time
+
+	// ETag is the object's etag.
+	ETag string
+
+	// LastModified is the object's last modified time.
+	LastModified time.Time
+
+	// Generation is the object's generation.
+	Generation int64
+}
+
+// Revalidation generates a long lived signed GET URL (valid for getTTL) and a
+// short lived signed HEAD URL (valid for headTTL) for the bucket and path,
+// retrieving the object's current validators using the HEAD URL.
+func (u *URLSigner) Revalidation(ctx context.Context, bucket, path string, getTTL, headTTL time.Duration) (*Revalidation, error) {
+	get := &SigningParams{Method: "GET", Bucket: bucket, Object: path}
+	getURL, err := u.MakeSignedContext(ctx, get, getTTL)
+	if err != nil {
+		return nil, err
+	}
+	headURL, err := u.MakeSignedContext(ctx, &SigningParams{Method: "HEAD", Bucket: bucket, Object: path}, headTTL)
+	if err != nil {
+		return nil, err
+	}
+	// retrieve validators
+	req, err := http.NewRequest("HEAD", headURL.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := u.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer drain(res)
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not retrieve %s: %s", get.ObjectPath(), res.Status)
+	}
+	r := &Revalidation{
+		GetURL:         getURL.URL,
+		GetExpiration:  getURL.Expiration,
+		HeadURL:        headURL.URL,
+		HeadExpiration: headURL.Expiration,
+		ETag:           res.Header.Get("ETag"),
+	}
+	if s := res.Header.Get("Last-Modified"); s != "" {
+		if r.LastModified, err = http.ParseTime(s); err != nil {
+			return nil, fmt.Errorf("invalid last modified %q", s)
+		}
+	}
+	if s := strings.TrimSpace(res.Header.Get("x-goog-generation")); s != "" {
+		if r.Generation, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid generation %q", s)
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,120 @@
+package gstorage
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	b64 "encoding/base64"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultSecretManagerURL is the base Secret Manager API URL.
+const DefaultSecretManagerURL = "https://secretmanager.googleapis.com/v1/"
+
+// WithSecretManagerKey is an option that loads Google Service Account
+// credentials stored as a Secret Manager secret, such as
+// projects/my-project/secrets/my-secret. When the secret name does not
+// specify a version, the latest version is used.
+//
+// The secret is accessed using the metadata server's default service account,
+// which must have the secretmanager.versions.access permission on the secret.
+func WithSecretManagerKey(ctx context.Context, secretName string) Option {
+	return WithSecretManagerKeyRefresh(ctx, secretName, 0)
+}
+
+// WithSecretManagerKeyRefresh is an option that loads Google Service Account
+// credentials stored as a Secret Manager secret, as with
+// WithSecretManagerKey, and when interval is not 0, periodically reloads the
+// secret until the context is closed, atomically swapping the private key.
+//
+// Reloaded credentials having a different client email than the initial
+// credentials, or keys weaker than the minimum key size, are ignored.
+//
+// The secret is loaded after all options have been applied, so that the
+// URLSigner's HTTP client (see WithHTTPClient) is used regardless of option
+// order.
+func WithSecretManagerKeyRefresh(ctx context.Context, secretName string, interval time.Duration) Option {
+	return func(u *URLSigner) error {
+		if !strings.Contains(secretName, "/versions/") {
+			secretName += "/versions/latest"
+		}
+		u.setup = append(u.setup, func(u *URLSigner) error {
+			m := newMetadataClient(u.client())
+			key, email, keyID, err := accessSecretKey(ctx, u.client(), m, secretName)
+			if err != nil {
+				return err
+			}
+			u.ClientEmail = email
+			if interval == 0 {
+				u.PrivateKey, u.Signer, u.Backend, u.keyID = key, nil, nil, keyID
+				return nil
+			}
+			b := newKeyBackend(key, keyID)
+			u.PrivateKey, u.Signer, u.Backend = nil, nil, b
+			u.refreshKey(ctx, b, email, interval, func(ctx context.Context) (crypto.Signer, string, string, error) {
+				key, email, keyID, err := accessSecretKey(ctx, u.client(), m, secretName)
+				if err != nil {
+					return nil, "", "", err
+				}
+				return key, email, keyID, nil
+			})
+			return nil
+		})
+		return nil
+	}
+}
+
+// accessSecretKey accesses the secret version, returning the private key,
+// client email, and private key id of the Google Service Account credentials
+// stored in the secret.
+func accessSecretKey(ctx context.Context, client *http.Client, ts TokenSource, name string) (*rsa.PrivateKey, string, string, error) {
+	buf, err := accessSecret(ctx, client, ts, name)
+	if err != nil {
+		return nil, "", "", err
+	}
+	key, email, keyID, err := parseCredentialsJSON(buf)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("secret %s: %v", name, err)
+	}
+	return key, email, keyID, nil
+}
+
+// accessSecret accesses the secret version, returning its payload.
+func accessSecret(ctx context.Context, client *http.Client, ts TokenSource, name string) ([]byte, error) {
+	tok, err := ts.AccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", DefaultSecretManagerURL+name+":access", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+tok)
+	var res struct {
+		Payload struct {
+			Data       string `json:"data"`
+			DataCrc32c string `json:"dataCrc32c"`
+		} `json:"payload"`
+	}
+	if err := doJSON(client, req.WithContext(ctx), &res); err != nil {
+		return nil, fmt.Errorf("could not access secret %s: %v", name, err)
+	}
+	buf, err := b64.StdEncoding.DecodeString(res.Payload.Data)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode secret %s: %v", name, err)
+	}
+	// verify checksum
+	if res.Payload.DataCrc32c != "" {
+		crc, err := strconv.ParseUint(res.Payload.DataCrc32c, 10, 32)
+		if err != nil || uint32(crc) != crc32.Checksum(buf, castagnoli) {
+			return nil, errors.New("secret payload checksum mismatch")
+		}
+	}
+	return buf, nil
+}
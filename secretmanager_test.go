@@ -0,0 +1,62 @@
+package gstorage
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// roundTripFunc wraps a func as a http.RoundTripper.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip satisfies the http.RoundTripper interface.
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestWithSecretManagerKey(t *testing.T) {
+	setenv(t, map[string]string{"GCE_METADATA_HOST": "metadata.test"})
+	payload, err := json.Marshal(map[string]interface{}{
+		"payload": map[string]string{"data": base64.StdEncoding.EncodeToString(testCredentialsJSON(t))},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	var paths []string
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		paths = append(paths, req.URL.Host+req.URL.Path)
+		var buf []byte
+		switch {
+		case req.URL.Host == "metadata.test" && strings.HasSuffix(req.URL.Path, "/token"):
+			buf = []byte(`{"access_token":"token","expires_in":3600}`)
+		case req.URL.Host == "secretmanager.googleapis.com" && req.Header.Get("Authorization") == "Bearer token":
+			buf = payload
+		default:
+			return &http.Response{StatusCode: http.StatusNotFound, Body: ioutil.NopCloser(bytes.NewReader(nil)), Request: req}, nil
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewReader(buf)), Request: req}, nil
+	})}
+	// the http client is used, regardless of option order
+	u, err := NewURLSigner(
+		WithSecretManagerKey(context.Background(), "projects/p/secrets/s"),
+		WithHTTPClient(client),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if u.ClientEmail != "test@example.iam.gserviceaccount.com" || !u.PrivateKey.Equal(loadTestKey(t)) {
+		t.Errorf("expected signer for the secret's credentials, got: %q", u.ClientEmail)
+	}
+	exp := []string{
+		"metadata.test/computeMetadata/v1/instance/service-accounts/default/token",
+		"secretmanager.googleapis.com/v1/projects/p/secrets/s/versions/latest:access",
+	}
+	if strings.Join(paths, " ") != strings.Join(exp, " ") {
+		t.Errorf("expected requests %q, got: %q", exp, paths)
+	}
+}
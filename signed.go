@@ -0,0 +1,72 @@
+package gstorage
+
+import (
+	"context"
+	"time"
+)
+
+// SignedURL is a signed URL, along with the information a client needs to
+// use it.
+type SignedURL struct {
+	// URL is the signed URL.
+	URL string
+
+	// Method is the HTTP method (GET, PUT, ...).
+	Method string
+
+	// Expiration is the expiration time of the signed URL.
+	Expiration time.Time
+
+	// Scheme is the signing scheme. Media CDN signed URLs (see
+	// WithCDNFallback) have the default scheme.
+	Scheme SigningScheme
+
+	// Headers are the headers the client must send with the request, exactly
+	// as given. See SigningParams.RequiredHeaders.
+	Headers map[string]string
+}
+
+// MakeSigned makes a signed URL for the specified signing params.
+func (u *URLSigner) MakeSigned(p *SigningParams, d time.Duration) (*SignedURL, error) {
+	return u.MakeSignedContext(context.Background(), p, d)
+}
+
+// MakeSignedContext makes a signed URL for the specified signing params,
+// using the context for any remote signing requests. See MakeContext.
+func (u *URLSigner) MakeSignedContext(ctx context.Context, p *SigningParams, d time.Duration) (*SignedURL, error) {
+	urlstr, expiration, err := u.make(ctx, p, d)
+	if err != nil {
+		return nil, err
+	}
+	s := &SignedURL{
+		URL:        urlstr,
+		Method:     p.Method,
+		Expiration: expiration,
+	}
+	if !p.NotBefore.IsZero() {
+		s.Headers = make(map[string]string)
+		return s, nil
+	}
+	s.Scheme = SigningSchemeV2
+	if u.scheme == SigningSchemeV4 {
+		s.Scheme = SigningSchemeV4
+	}
+	s.Headers = u.withHeaders(*p).RequiredHeaders()
+	return s, nil
+}
+
+// MakeSignedURL makes a signed URL for the method.
+func (u *URLSigner) MakeSignedURL(method, bucket, path string, d time.Duration, headers map[string]string) (*SignedURL, error) {
+	return u.MakeSignedURLContext(context.Background(), method, bucket, path, d, headers)
+}
+
+// MakeSignedURLContext makes a signed URL for the method, using the context
+// for any remote signing requests.
+func (u *URLSigner) MakeSignedURLContext(ctx context.Context, method, bucket, path string, d time.Duration, headers map[string]string) (*SignedURL, error) {
+	return u.MakeSignedContext(ctx, &SigningParams{
+		Method:  method,
+		Headers: headerValues(headers),
+		Bucket:  bucket,
+		Object:  path,
+	}, d)
+}
@@ -0,0 +1,113 @@
+package gstorage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ValidationError is the error returned when signing params are not valid,
+// containing each of the validation errors (eg, *HeaderError,
+// *HeaderLimitError).
+type ValidationError struct {
+	Errors []error
+}
+
+// Error satisfies the error interface.
+func (err *ValidationError) Error() string {
+	s := make([]string, len(err.Errors))
+	for i, e := range err.Errors {
+		s[i] = e.Error()
+	}
+	return strings.Join(s, "; ")
+}
+
+// Validate validates the signing params' method, bucket and object names
+// (see ValidateBucketName and ValidateObjectName), expiration, headers, and
+// extra query parameters, returning a *ValidationError with all validation
+// errors when not valid. The object name may be empty, and the expiration may
+// be zero, as it is determined when signing.
+//
+// Signing params are validated by the URLSigner when signing, along with the
+// URLSigner's signing scheme restrictions, and an expiration that is zero or
+// not in the future is rejected with an error wrapping ErrExpired.
+func (p SigningParams) Validate() error {
+	return validationError(p.validate())
+}
+
+// Is returns true when any of the validation errors matches target, for use
+// with errors.Is.
+func (err *ValidationError) Is(target error) bool {
+	for _, e := range err.Errors {
+		if errors.Is(e, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first validation error that matches target, for use with
+// errors.As.
+func (err *ValidationError) As(target interface{}) bool {
+	for _, e := range err.Errors {
+		if errors.As(e, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// validate returns the signing params' validation errors.
+func (p SigningParams) validate() []error {
+	var errs []error
+	if err := Method(p.Method).Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := ValidateBucketName(strings.Trim(p.Bucket, "/")); err != nil {
+		errs = append(errs, err)
+	}
+	if object := strings.TrimPrefix(p.Object, "/"); object != "" {
+		if err := ValidateObjectName(object); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if p.TTL < 0 {
+		errs = append(errs, errors.New("ttl must not be negative"))
+	}
+	if !p.Expiration.IsZero() && !p.NotBefore.IsZero() && !p.Expiration.After(p.NotBefore) {
+		errs = append(errs, errors.New("expiration must be after not before"))
+	}
+	if err := p.checkHeaders(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := p.checkExtraQuery(); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// validate validates the signing params, as with SigningParams.Validate,
+// including the restrictions of the URLSigner's signing scheme. When signing,
+// the expiration must be in the future.
+func (u *URLSigner) validate(p *SigningParams, signing bool) error {
+	errs := p.validate()
+	now := u.now()
+	if signing && !p.Expiration.After(now) {
+		errs = append(errs, &wrappedError{"expiration must be in the future", ErrExpired})
+	}
+	if u.scheme == SigningSchemeV4 && p.NotBefore.IsZero() && !p.Expiration.IsZero() {
+		if p.Expiration.After(now.Add(v4MaxExpiration)) {
+			errs = append(errs, fmt.Errorf("expiration must not exceed %v for v4 signatures", v4MaxExpiration))
+		}
+	}
+	return validationError(errs)
+}
+
+// validationError returns a *ValidationError for errs, or nil if there are no
+// errors.
+func validationError(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: errs}
+}
@@ -0,0 +1,142 @@
+package gstorage
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		p    SigningParams
+		errs []error
+	}{
+		{SigningParams{Method: "GET", Bucket: "bucket", Object: "file.txt"}, nil},
+		{SigningParams{Method: "GET", Bucket: "bucket"}, nil},
+		{SigningParams{Method: "PUT", Bucket: "/bucket/", Object: "/file.txt", Expiration: now, NotBefore: now.Add(-time.Hour)}, nil},
+		{SigningParams{Bucket: "bucket", Object: "file.txt"}, []error{ErrInvalidMethod}},
+		{SigningParams{Method: "PATCH", Bucket: "bucket", Object: "file.txt"}, []error{ErrInvalidMethod}},
+		{SigningParams{Method: "GET", Bucket: "B", Object: "file.txt"}, []error{ErrInvalidBucket}},
+		{SigningParams{Method: "GET", Bucket: "bucket", Object: ".."}, []error{ErrInvalidObject}},
+		{SigningParams{Method: "GET", Bucket: "bucket", Object: "file.txt", TTL: -time.Minute}, []error{nil}},
+		{SigningParams{Method: "GET", Bucket: "bucket", Object: "file.txt", Expiration: now, NotBefore: now}, []error{nil}},
+		{SigningParams{Method: "GET", Bucket: "bucket", Object: "file.txt", Headers: http.Header{"X-Goog-Date": {"x"}}}, []error{&HeaderError{}}},
+		{SigningParams{Method: "GET", Bucket: "bucket", Object: "file.txt", ExtraQuery: url.Values{"X-Goog-Signature": {"x"}}}, []error{nil}},
+		{SigningParams{Method: "PATCH", Bucket: "B", Object: "..", TTL: -time.Minute}, []error{ErrInvalidMethod, ErrInvalidBucket, ErrInvalidObject, nil}},
+	}
+	for i, test := range tests {
+		err := test.p.Validate()
+		if test.errs == nil {
+			if err != nil {
+				t.Errorf("test %d expected no error, got: %v", i, err)
+			}
+			continue
+		}
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			t.Errorf("test %d expected *ValidationError, got: %T %v", i, err, err)
+			continue
+		}
+		if len(verr.Errors) != len(test.errs) {
+			t.Errorf("test %d expected %d errors, got: %v", i, len(test.errs), verr.Errors)
+			continue
+		}
+		for j, exp := range test.errs {
+			switch e := exp.(type) {
+			case nil:
+			case *HeaderError:
+				if !errors.As(verr.Errors[j], &e) {
+					t.Errorf("test %d expected error %d to be %T, got: %v", i, j, exp, verr.Errors[j])
+				}
+			default:
+				if !errors.Is(verr.Errors[j], exp) {
+					t.Errorf("test %d expected error %d to be %v, got: %v", i, j, exp, verr.Errors[j])
+				}
+			}
+		}
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	p := SigningParams{
+		Method:  "PATCH",
+		Bucket:  "bucket",
+		Object:  "..",
+		Headers: http.Header{"X-Goog-Date": {"x"}},
+	}
+	err := p.Validate()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, target := range []error{ErrInvalidMethod, ErrInvalidObject} {
+		if !errors.Is(err, target) {
+			t.Errorf("expected errors.Is %v, got: %v", target, err)
+		}
+	}
+	if errors.Is(err, ErrInvalidBucket) {
+		t.Errorf("expected errors.Is %v to be false", ErrInvalidBucket)
+	}
+	var herr *HeaderError
+	if !errors.As(err, &herr) || herr.Header != "X-Goog-Date" {
+		t.Errorf("expected *HeaderError for X-Goog-Date, got: %v", err)
+	}
+	var lerr *HeaderLimitError
+	if errors.As(err, &lerr) {
+		t.Errorf("expected errors.As *HeaderLimitError to be false")
+	}
+}
+
+func TestSignExpiration(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		scheme     SigningScheme
+		expiration time.Time
+		d          time.Duration
+		exp        bool
+	}{
+		{SigningSchemeV2, time.Time{}, 0, true},
+		{SigningSchemeV2, now.Add(-time.Minute), 0, true},
+		{SigningSchemeV2, now, 0, true},
+		{SigningSchemeV2, time.Time{}, -time.Minute, true},
+		{SigningSchemeV2, now.Add(time.Minute), 0, false},
+		{SigningSchemeV2, time.Time{}, time.Minute, false},
+		{SigningSchemeV4, time.Time{}, 0, true},
+		{SigningSchemeV4, now.Add(-time.Minute), 0, true},
+		{SigningSchemeV4, now.Add(time.Minute), 0, false},
+	}
+	for i, test := range tests {
+		u := &URLSigner{
+			PrivateKey:  loadTestKey(t),
+			ClientEmail: "test@example.com",
+			scheme:      test.scheme,
+			clock:       func() time.Time { return now },
+		}
+		p := &SigningParams{Method: "GET", Bucket: "bucket", Object: "file.txt", Expiration: test.expiration}
+		_, err := u.Make(p, test.d)
+		switch {
+		case !test.exp && err != nil:
+			t.Errorf("test %d expected no error, got: %v", i, err)
+		case test.exp && !errors.Is(err, ErrExpired):
+			t.Errorf("test %d expected ErrExpired, got: %v", i, err)
+		case test.exp:
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Errorf("test %d expected *ValidationError, got: %T", i, err)
+			}
+		}
+		if test.d != 0 {
+			continue
+		}
+		// signatures only
+		_, err = u.SigningParams(p)
+		switch {
+		case !test.exp && err != nil:
+			t.Errorf("test %d expected no error, got: %v", i, err)
+		case test.exp && !errors.Is(err, ErrExpired):
+			t.Errorf("test %d expected ErrExpired, got: %v", i, err)
+		}
+	}
+}
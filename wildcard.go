@@ -0,0 +1,139 @@
+package gstorage
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// ParseGSURL parses a gs://bucket/object URL, returning the bucket and
+// object.
+func ParseGSURL(urlstr string) (string, string, error) {
+	if !strings.HasPrefix(urlstr, "gs://") {
+		return "", "", errors.New("url must have gs:// scheme")
+	}
+	s := strings.TrimPrefix(urlstr, "gs://")
+	bucket, object := s, ""
+	if i := strings.Index(s, "/"); i != -1 {
+		bucket, object = s[:i], s[i+1:]
+	}
+	if bucket == "" {
+		return "", "", errors.New("url missing bucket")
+	}
+	return bucket, object, nil
+}
+
+// HasWildcard returns true when s contains a gsutil-style wildcard (*, ?, or
+// [).
+func HasWildcard(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// Expand expands a gsutil-style wildcard pattern (eg, gs://bucket/prefix/*.csv)
+// to the matching objects, using a signed bucket listing.
+//
+// A * matches any sequence of characters within a path segment, ** matches
+// any sequence of characters including /, ? matches a single character, and
+// [...] matches a character class. Wildcards are not supported in the bucket
+// name. When pattern contains no wildcards, the named object is returned
+// without listing the bucket.
+func (u *URLSigner) Expand(ctx context.Context, pattern string) ([]ObjectInfo, error) {
+	bucket, object, err := ParseGSURL(pattern)
+	switch {
+	case err != nil:
+		return nil, err
+	case HasWildcard(bucket):
+		return nil, errors.New("wildcards are not supported in bucket names")
+	case !HasWildcard(object):
+		return []ObjectInfo{{Bucket: bucket, Name: object}}, nil
+	}
+	re, err := wildcardRegexp(object)
+	if err != nil {
+		return nil, err
+	}
+	var objs []ObjectInfo
+	err = u.listAll(ctx, bucket, object[:strings.IndexAny(object, "*?[")], func(obj ObjectInfo) error {
+		if re.MatchString(obj.Name) {
+			objs = append(objs, obj)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return objs, nil
+}
+
+// ExpandPage expands a single page of the gs:// URL pattern, as with Expand,
+// starting from the resume token returned by a previous call (or from the
+// beginning when token is empty). The returned resume token is empty when
+// there are no more objects. Pages may contain no matching objects while the
+// returned resume token is not empty.
+//
+// Resume tokens are opaque, and can be persisted to checkpoint and resume
+// large expansions across process restarts.
+func (u *URLSigner) ExpandPage(ctx context.Context, pattern, token string) ([]ObjectInfo, string, error) {
+	bucket, object, err := ParseGSURL(pattern)
+	switch {
+	case err != nil:
+		return nil, "", err
+	case HasWildcard(bucket):
+		return nil, "", errors.New("wildcards are not supported in bucket names")
+	case !HasWildcard(object):
+		return []ObjectInfo{{Bucket: bucket, Name: object}}, "", nil
+	}
+	re, err := wildcardRegexp(object)
+	if err != nil {
+		return nil, "", err
+	}
+	marker, err := decodeResumeToken(token, "expand", pattern)
+	if err != nil {
+		return nil, "", err
+	}
+	page, next, err := u.listPage(ctx, bucket, object[:strings.IndexAny(object, "*?[")], marker)
+	if err != nil {
+		return nil, "", err
+	}
+	var objs []ObjectInfo
+	for _, obj := range page {
+		if re.MatchString(obj.Name) {
+			objs = append(objs, obj)
+		}
+	}
+	return objs, encodeResumeToken("expand", pattern, next), nil
+}
+
+// wildcardRegexp converts a gsutil-style wildcard pattern to a regexp.
+func wildcardRegexp(pattern string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				sb.WriteString(".*")
+				i++
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			j := strings.IndexByte(pattern[i+1:], ']')
+			if j == -1 {
+				return nil, errors.New("wildcard has unterminated character class")
+			}
+			class := pattern[i+1 : i+1+j]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.Replace(class, `\`, `\\`, -1) + "]")
+			i += j + 1
+		default:
+			sb.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}